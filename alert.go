@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// alertPayload is POSTed to alert_webhook_url. Text makes it render as-is in
+// Slack incoming webhooks.
+type alertPayload struct {
+	Event               string    `json:"event"`
+	ValidatorID         int       `json:"validatorId"`
+	Nonce               int       `json:"nonce"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	Timestamp           time.Time `json:"timestamp"`
+	Text                string    `json:"text"`
+}
+
+// alerter posts a webhook once a validator's stake-update failed
+// threshold times in a row, and again when it recovers. Posts are queued
+// and sent from a single goroutine, so a slow webhook never stalls a worker.
+type alerter struct {
+	url       string
+	threshold int
+	client    *http.Client
+	queue     chan alertPayload
+
+	mu       sync.Mutex
+	failures map[int]int
+	alerted  map[int]bool
+}
+
+// alerts is nil unless alert_webhook_url is set, in which case runWatch
+// starts it.
+var alerts *alerter
+
+func newAlerter(url string, threshold int) *alerter {
+	return &alerter{
+		url:       url,
+		threshold: threshold,
+		client:    &http.Client{Timeout: 10 * time.Second, Transport: HTTPTransport},
+		queue:     make(chan alertPayload, 64),
+		failures:  map[int]int{},
+		alerted:   map[int]bool{},
+	}
+}
+
+// Failure records a failed stake-update submission.
+func (a *alerter) Failure(validatorId int, nonce int, err error) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.failures[validatorId]++
+	failures := a.failures[validatorId]
+	if failures < a.threshold || a.alerted[validatorId] {
+		return
+	}
+	a.alerted[validatorId] = true
+	a.enqueue(alertPayload{
+		Event:               "failing",
+		ValidatorID:         validatorId,
+		Nonce:               nonce,
+		Error:               err.Error(),
+		ConsecutiveFailures: failures,
+		Timestamp:           time.Now(),
+		Text:                fmt.Sprintf("stake-update for validator %d nonce %d failed %d times in a row: %v", validatorId, nonce, failures, err),
+	})
+}
+
+// Success records a successful submission, sending a recovery alert if a
+// failure alert went out before.
+func (a *alerter) Success(validatorId int, nonce int) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	wasAlerted := a.alerted[validatorId]
+	a.failures[validatorId] = 0
+	a.alerted[validatorId] = false
+	if !wasAlerted {
+		return
+	}
+	a.enqueue(alertPayload{
+		Event:       "recovered",
+		ValidatorID: validatorId,
+		Nonce:       nonce,
+		Timestamp:   time.Now(),
+		Text:        fmt.Sprintf("stake-update for validator %d recovered with nonce %d", validatorId, nonce),
+	})
+}
+
+func (a *alerter) enqueue(payload alertPayload) {
+	select {
+	case a.queue <- payload:
+	default:
+		slog.Warn("Alert queue full, dropping alert", "validator_id", payload.ValidatorID, "event", payload.Event)
+	}
+}
+
+// run sends queued alerts until ctx is cancelled.
+func (a *alerter) run(ctx context.Context) {
+	for {
+		select {
+		case payload := <-a.queue:
+			if err := a.post(ctx, payload); err != nil {
+				slog.Error("Error sending alert webhook", "validator_id", payload.ValidatorID, "event", payload.Event, "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *alerter) post(ctx context.Context, payload alertPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+func init() {
+	registerMode(&mode{
+		Name:        "audit",
+		Args:        "[-json] -from <block> -to <block> <validator_id>",
+		Description: "Print every stake-update of a validator between two Ethereum blocks, and whether Heimdall applied it",
+		Run:         runAudit,
+	})
+}
+
+// auditEntry is one row of the audit output.
+type auditEntry struct {
+	Nonce           string `json:"nonce"`
+	Block           string `json:"block"`
+	TransactionHash string `json:"tx_hash"`
+	LogIndex        string `json:"log_index"`
+	TotalStaked     string `json:"total_staked"`
+	// Applied is whether Heimdall's nonce has reached the stake-update.
+	Applied bool `json:"applied"`
+}
+
+func runAudit(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "Print JSON instead of a table")
+	fromBlock := flags.Uint64("from", 0, "First Ethereum block of the range")
+	toBlock := flags.Uint64("to", 0, "Last Ethereum block of the range, inclusive")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a single validator id")
+	}
+	validatorId, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || validatorId < 0 {
+		return fmt.Errorf("invalid validator id %q", flags.Arg(0))
+	}
+	if *toBlock == 0 || *fromBlock > *toBlock {
+		return fmt.Errorf("invalid block range %d to %d", *fromBlock, *toBlock)
+	}
+
+	setupServiceClients()
+	stakeUpdates, err := validatorProfile(validatorId).Subgraph.StakeUpdatesInRange(ctx, validatorId, *fromBlock, *toBlock)
+	if err != nil {
+		return err
+	}
+	heimdallNonce, err := getHeimdallValidatorNonce(ctx, validatorId)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]auditEntry, 0, len(stakeUpdates))
+	for _, stakeUpdate := range stakeUpdates {
+		// Validated by the subgraph client.
+		nonce, _ := strconv.Atoi(stakeUpdate.Nonce)
+		entries = append(entries, auditEntry{
+			Nonce:           stakeUpdate.Nonce,
+			Block:           stakeUpdate.Block,
+			TransactionHash: stakeUpdate.TransactionHash,
+			LogIndex:        stakeUpdate.LogIndex,
+			TotalStaked:     stakeUpdate.TotalStaked,
+			Applied:         nonce <= heimdallNonce,
+		})
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NONCE\tBLOCK\tTX HASH\tLOG INDEX\tTOTAL STAKED\tAPPLIED")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\n", entry.Nonce, entry.Block, entry.TransactionHash, entry.LogIndex, entry.TotalStaked, entry.Applied)
+	}
+	w.Flush()
+	fmt.Printf("%d stake-updates, Heimdall nonce %d\n", len(entries), heimdallNonce)
+	return nil
+}
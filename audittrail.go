@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"stake-update-go/watch"
+)
+
+// Outcomes of an audit trail entry.
+const (
+	auditSubmitted     = "submitted"
+	auditFailed        = "failed"
+	auditAlreadyExists = "already_exists"
+	auditDryRun        = "dry_run"
+)
+
+// auditTrailEntry is a line of the audit_file.
+type auditTrailEntry struct {
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	ValidatorID int       `json:"validator_id"`
+	Nonce       int       `json:"nonce"`
+	Block       string    `json:"block"`
+	// StakedAmount is set for stake-updates, NewSigner for signer-updates
+	// and DeactivationEpoch for validator-exits.
+	StakedAmount      string `json:"staked_amount,omitempty"`
+	NewSigner         string `json:"new_signer,omitempty"`
+	DeactivationEpoch string `json:"deactivation_epoch,omitempty"`
+	TxHash            string `json:"tx_hash"`
+	SubmitMode        string `json:"submit_mode"`
+	Outcome           string `json:"outcome"`
+	Error             string `json:"error,omitempty"`
+}
+
+// auditTrail appends a JSON line for every submission attempt to
+// audit_file, apart from the operational logs. Every line is synced to disk
+// before Record returns. Once the file would grow past maxBytes it is
+// renamed with a timestamp suffix and a new one started, and a file moved
+// away by an external tool such as logrotate is noticed and reopened.
+type auditTrail struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	file     *os.File
+	size     int64
+}
+
+// auditLog is nil unless audit_file is set.
+var auditLog *auditTrail
+
+func openAuditTrail(path string, maxBytes int64) (*auditTrail, error) {
+	trail := &auditTrail{path: path, maxBytes: maxBytes}
+	if err := trail.open(); err != nil {
+		return nil, err
+	}
+	return trail, nil
+}
+
+func (t *auditTrail) open() error {
+	file, err := os.OpenFile(t.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t.file = file
+	t.size = info.Size()
+	return nil
+}
+
+func stakeUpdateAudit(stakeUpdate StakeUpdate, validatorId int, nonce int) auditTrailEntry {
+	return auditTrailEntry{
+		Kind:         "stake-update",
+		ValidatorID:  validatorId,
+		Nonce:        nonce,
+		Block:        stakeUpdate.Block,
+		StakedAmount: stakeUpdate.TotalStaked,
+		TxHash:       stakeUpdate.TransactionHash,
+	}
+}
+
+func signerUpdateAudit(change SignerChange, validatorId int, nonce int) auditTrailEntry {
+	return auditTrailEntry{
+		Kind:        "signer-update",
+		ValidatorID: validatorId,
+		Nonce:       nonce,
+		Block:       change.Block,
+		NewSigner:   change.NewSigner,
+		TxHash:      change.TransactionHash,
+	}
+}
+
+func validatorExitAudit(exit ValidatorExit, validatorId int, nonce int) auditTrailEntry {
+	return auditTrailEntry{
+		Kind:              "validator-exit",
+		ValidatorID:       validatorId,
+		Nonce:             nonce,
+		Block:             exit.Block,
+		DeactivationEpoch: exit.DeactivationEpoch,
+		TxHash:            exit.TransactionHash,
+	}
+}
+
+// eventAudit returns the audit trail entry of event.
+func eventAudit(event watch.Event, validatorId int, nonce int) auditTrailEntry {
+	switch event := event.(type) {
+	case watch.SignerChangeEvent:
+		return signerUpdateAudit(event.SignerChange, validatorId, nonce)
+	case watch.ValidatorExitEvent:
+		return validatorExitAudit(event.ValidatorExit, validatorId, nonce)
+	case watch.StakeUpdateEvent:
+		return stakeUpdateAudit(event.StakeUpdate, validatorId, nonce)
+	}
+	return auditTrailEntry{Kind: event.Kind(), ValidatorID: validatorId, Nonce: nonce, Block: event.BlockNumber(), TxHash: event.TxHash()}
+}
+
+// auditEvent records the submission attempt of event, which returned err,
+// or would have been made in a dry run.
+func auditEvent(validatorId int, nonce int, event watch.Event, dryRun bool, err error) {
+	outcome := auditOutcome(err)
+	if dryRun {
+		outcome = auditDryRun
+	}
+	logger := validatorLogger(validatorId).With("nonce", nonce, "kind", event.Kind())
+	recordAudit(logger, eventAudit(event, validatorId, nonce), outcome, err)
+}
+
+// auditOutcome is the outcome of a submission that returned err.
+func auditOutcome(err error) string {
+	switch {
+	case err == nil:
+		return auditSubmitted
+	case classifyError(err) == watch.CategoryAlreadyExists:
+		return auditAlreadyExists
+	default:
+		return auditFailed
+	}
+}
+
+// Record appends entry with the given outcome.
+func (t *auditTrail) Record(entry auditTrailEntry, outcome string, submitErr error) error {
+	if t == nil {
+		return nil
+	}
+	entry.Time = time.Now().UTC()
+	entry.SubmitMode = SubmitMode
+	entry.Outcome = outcome
+	if submitErr != nil {
+		entry.Error = submitErr.Error()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err = t.reopenIfMoved(); err != nil {
+		return err
+	}
+	var rotateErr error
+	if t.maxBytes > 0 && t.size > 0 && t.size+int64(len(line)) > t.maxBytes {
+		rotateErr = t.rotate()
+	}
+	n, err := t.file.Write(line)
+	t.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err = t.file.Sync(); err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+// reopenIfMoved reopens the path when the open file is no longer the one
+// found there.
+func (t *auditTrail) reopenIfMoved() error {
+	current, err := t.file.Stat()
+	if err != nil {
+		t.file.Close()
+		return t.open()
+	}
+	info, err := os.Stat(t.path)
+	if err == nil && os.SameFile(current, info) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	t.file.Close()
+	return t.open()
+}
+
+// rotate renames the file, e.g. to audit.jsonl.20240102T150405.000Z, and
+// starts a new one. The current file is kept when it can't be renamed.
+func (t *auditTrail) rotate() error {
+	t.file.Close()
+	base := t.path + "." + time.Now().UTC().Format("20060102T150405.000Z")
+	rotated := base
+	for i := 1; fileExists(rotated); i++ {
+		rotated = fmt.Sprintf("%s.%d", base, i)
+	}
+	renameErr := os.Rename(t.path, rotated)
+	if err := t.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("unable to rotate %s: %v", t.path, renameErr)
+	}
+	return nil
+}
+
+// recordAudit appends to the audit trail, logging when it can't.
+func recordAudit(logger *slog.Logger, entry auditTrailEntry, outcome string, submitErr error) {
+	if err := auditLog.Record(entry, outcome, submitErr); err != nil {
+		logger.Error("Unable to write the audit trail", "audit_file", AuditFile, "err", err)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (t *auditTrail) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.file.Close()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"stake-update-go/watch"
+)
+
+// breakerState is the state of the submission circuit breaker.
+type breakerState int
+
+const (
+	// breakerClosed lets every submission through.
+	breakerClosed breakerState = iota
+	// breakerOpen holds back submissions until the cooldown has passed.
+	breakerOpen
+	// breakerHalfOpen lets a single trial submission through, whose outcome
+	// closes or re-opens the breaker.
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops submitting after HeimdallcliBreakerFailures
+// consecutive failed submissions, as when the Heimdall node is out of sync
+// or the keyring is locked, so the tool doesn't burn retries and fees on
+// submissions certain to fail. The loop keeps polling meanwhile. Each profile
+// has its own, shared by the validators submitting through its node, so a
+// broken deployment doesn't hold back the others.
+type circuitBreaker struct {
+	// profile names the profile the breaker belongs to.
+	profile  string
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	// trial is whether the half-open trial submission is in progress.
+	trial bool
+}
+
+func newCircuitBreaker(profile string) *circuitBreaker {
+	return &circuitBreaker{profile: profile}
+}
+
+// Allow reports whether a submission may go ahead. Every caller allowed
+// through must report the outcome with Record.
+func (b *circuitBreaker) Allow() bool {
+	if HeimdallcliBreakerFailures == 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if time.Since(b.openedAt) < HeimdallcliBreakerCooldown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		slog.Info("Circuit breaker half-open, trying a single submission", "profile", b.profile, "cooldown", HeimdallcliBreakerCooldown)
+	}
+	if b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// Record reports the outcome of a submission Allow let through. Heimdall
+// already having the stake-update counts as a success, since the node
+// answered, and a submission cut short by shutdown counts as neither.
+func (b *circuitBreaker) Record(ctx context.Context, err error) {
+	if HeimdallcliBreakerFailures == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if err == nil || classifyError(err) == watch.CategoryAlreadyExists {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+			slog.Info("Circuit breaker closed, submitting stake-updates again", "profile", b.profile)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= HeimdallcliBreakerFailures {
+		b.openedAt = time.Now()
+		if b.state != breakerOpen {
+			b.setState(breakerOpen)
+			slog.Warn("Circuit breaker open, holding back submissions", "profile", b.profile, "consecutive_failures", b.failures, "cooldown", HeimdallcliBreakerCooldown, "err", err)
+		}
+	}
+}
+
+// State returns the current state.
+func (b *circuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerStates returns the state of every profile's breaker by profile name.
+func breakerStates() map[string]string {
+	states := map[string]string{}
+	for _, p := range allProfiles() {
+		states[p.Name] = p.breaker.State().String()
+	}
+	return states
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	b.state = state
+	metrics.SetBreakerState(b.profile, state)
+}
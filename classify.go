@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"stake-update-go/watch"
+)
+
+type errorRule struct {
+	Category watch.Category
+	Pattern  *regexp.Regexp
+}
+
+var defaultErrorRules = []errorRule{
+	{watch.CategoryAlreadyExists, regexp.MustCompile(`(?i)already (processed|exists|submitted)`)},
+	{watch.CategoryFatal, regexp.MustCompile(`(?i)executable file not found|unknown (flag|command)|key not found`)},
+	{watch.CategorySkip, regexp.MustCompile(`(?i)not indexed|too recent`)},
+	{watch.CategoryRetry, regexp.MustCompile(`(?i)timeout|connection (refused|reset)|EOF|sequence mismatch|mempool|too many requests`)},
+}
+
+// ErrorRules are consulted in order, first match wins. Rules from
+// `error_rules` come before the defaults so operators can override them.
+var ErrorRules = defaultErrorRules
+
+// parseErrorRules parses `error_rules`, a semicolon separated list of
+// category:regex entries, e.g. `skip:(?i)indexing;fatal:bad key`.
+func parseErrorRules(value string) ([]errorRule, error) {
+	var rules []errorRule
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid error rule %q, expected category:regex", entry)
+		}
+		category := watch.Category(strings.TrimSpace(parts[0]))
+		switch category {
+		case watch.CategoryRetry, watch.CategoryFatal, watch.CategoryAlreadyExists, watch.CategorySkip:
+		default:
+			return nil, fmt.Errorf("invalid error rule category %q", category)
+		}
+		pattern, err := regexp.Compile(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid error rule pattern %q: %v", parts[1], err)
+		}
+		rules = append(rules, errorRule{Category: category, Pattern: pattern})
+	}
+	return rules, nil
+}
+
+// classifyError returns the category of the first rule matching err, and
+// retry when nothing matches.
+func classifyError(err error) watch.Category {
+	message := err.Error()
+	for _, rule := range ErrorRules {
+		if rule.Pattern.MatchString(message) {
+			return rule.Category
+		}
+	}
+	return watch.CategoryRetry
+}
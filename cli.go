@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// mode is an operating mode selectable as the first positional argument.
+type mode struct {
+	Name        string
+	Args        string
+	Description string
+	Run         func(ctx context.Context, args []string) error
+	// Default marks the mode used when no mode name is given.
+	Default bool
+}
+
+var (
+	modes       []*mode
+	defaultMode string
+)
+
+// registerMode makes m selectable on the command line. The mode marked
+// Default, or else the first registered one, is used when no mode name is
+// given.
+func registerMode(m *mode) {
+	if defaultMode == "" || m.Default {
+		defaultMode = m.Name
+	}
+	modes = append(modes, m)
+}
+
+func findMode(name string) *mode {
+	for _, m := range modes {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// selectMode picks the mode named by the first argument, falling back to the
+// default mode so that `stake-update <validator_id>` keeps working.
+func selectMode(args []string) (*mode, []string) {
+	if len(args) > 0 {
+		if m := findMode(args[0]); m != nil {
+			return m, args[1:]
+		}
+	}
+	return findMode(defaultMode), args
+}
+
+func printModes() {
+	w := tabwriter.NewWriter(flag.CommandLine.Output(), 0, 4, 2, ' ', 0)
+	for _, m := range modes {
+		description := m.Description
+		if m.Name == defaultMode {
+			description += " (default)"
+		}
+		fmt.Fprintf(w, "  %s %s\t%s\n", m.Name, m.Args, description)
+	}
+	w.Flush()
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [mode] <args>\n\nModes:\n", os.Args[0])
+	printModes()
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// validatorList collects validator ids from repeated or comma separated
+// -validator flags.
+type validatorList []int
+
+// Validators are the ids passed with -validator.
+var Validators validatorList
+
+func (v *validatorList) String() string {
+	ids := make([]string, len(*v))
+	for i, id := range *v {
+		ids[i] = strconv.Itoa(id)
+	}
+	return strings.Join(ids, ",")
+}
+
+func (v *validatorList) Set(value string) error {
+	ids, err := parseValidatorIds(value)
+	if err != nil {
+		return err
+	}
+	*v = append(*v, ids...)
+	return nil
+}
+
+// parseValidatorIds parses a comma separated list of validator ids.
+func parseValidatorIds(value string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid validator id %q", part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// uniqueValidatorIds drops repeated ids, keeping the first occurrence.
+func uniqueValidatorIds(ids []int) []int {
+	seen := map[int]bool{}
+	unique := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,96 @@
+package clients
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// finalityAge is how old a block must be before it's cached. Ethereum
+// finalizes after two epochs, about 13 minutes, after which a block never
+// changes.
+const finalityAge = 15 * time.Minute
+
+// CachedBlocks keeps the most recently used finalized blocks in memory, so
+// nonces sharing a block don't each fetch it from the RPC. Younger blocks
+// may still be reorged and are always fetched.
+type CachedBlocks struct {
+	Blocks
+
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cachedBlock struct {
+	number string
+	block  *types.Block
+}
+
+// NewCachedBlocks wraps blocks with an LRU cache holding up to size blocks.
+func NewCachedBlocks(blocks Blocks, size int) *CachedBlocks {
+	return &CachedBlocks{
+		Blocks:  blocks,
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *CachedBlocks) Block(ctx context.Context, blockNumber string) (*types.Block, error) {
+	c.mu.Lock()
+	if element, ok := c.entries[blockNumber]; ok {
+		c.order.MoveToFront(element)
+		block := element.Value.(*cachedBlock).block
+		c.mu.Unlock()
+		return block, nil
+	}
+	c.mu.Unlock()
+
+	block, err := c.Blocks.Block(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(time.Unix(int64(block.Time()), 0)) >= finalityAge {
+		c.add(blockNumber, block)
+	}
+	return block, nil
+}
+
+func (c *CachedBlocks) add(blockNumber string, block *types.Block) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[blockNumber]; ok {
+		return
+	}
+	c.entries[blockNumber] = c.order.PushFront(&cachedBlock{number: blockNumber, block: block})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedBlock).number)
+	}
+}
+
+// CachedBlock describes a block held by CachedBlocks.
+type CachedBlock struct {
+	Number string `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+// Entries returns the cached blocks, most recently used first.
+func (c *CachedBlocks) Entries() []CachedBlock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]CachedBlock, 0, c.order.Len())
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		cached := element.Value.(*cachedBlock)
+		entries = append(entries, CachedBlock{Number: cached.number, Hash: cached.block.Hash().Hex()})
+	}
+	return entries
+}
@@ -0,0 +1,151 @@
+// Package clients talks to everything outside the process: the Polygon
+// subgraph, the Heimdall REST API, the Ethereum RPC and the heimdallcli
+// binary. Each one sits behind an interface so the watch loop can be driven
+// by fakes.
+package clients
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Subgraph reads stake-updates indexed from Ethereum.
+type Subgraph interface {
+	// LatestNonce returns the highest nonce of the validator among its
+	// stake-updates, signer changes and unstake initiations, each of which
+	// takes a nonce, zero when it has none of them.
+	LatestNonce(ctx context.Context, validatorId int) (int, error)
+	// LatestNonces returns what LatestNonce does for every validator in a
+	// single request. Validators without any of these events are absent from
+	// the result.
+	LatestNonces(ctx context.Context, validatorIds []int) (map[int]int, error)
+	// StakeUpdate returns the stake-update with the given nonce, or
+	// ErrStakeUpdateNotIndexed while the subgraph hasn't indexed it.
+	StakeUpdate(ctx context.Context, validatorId int, nonce int) (StakeUpdate, error)
+	// SignerChange returns the signer change with the given nonce, or
+	// ErrSignerChangeNotFound when the subgraph has none.
+	SignerChange(ctx context.Context, validatorId int, nonce int) (SignerChange, error)
+	// ValidatorExit returns the unstake initiation with the given nonce, or
+	// ErrValidatorExitNotFound when the subgraph has none.
+	ValidatorExit(ctx context.Context, validatorId int, nonce int) (ValidatorExit, error)
+	// StakeUpdatesInRange returns every stake-update of the validator in
+	// blocks fromBlock to toBlock inclusive, oldest first.
+	StakeUpdatesInRange(ctx context.Context, validatorId int, fromBlock uint64, toBlock uint64) ([]StakeUpdate, error)
+	// IndexedBlock returns the latest Ethereum block the subgraph has
+	// indexed.
+	IndexedBlock(ctx context.Context) (uint64, error)
+}
+
+// Heimdall reads validator state from the Heimdall REST API.
+type Heimdall interface {
+	// Validator returns the validator, or an error wrapping
+	// ErrValidatorNotFound when Heimdall doesn't know it.
+	Validator(ctx context.Context, validatorId int) (*ValidatorResponse, error)
+	// Epoch returns the current epoch, which on Heimdall is the checkpoint
+	// count.
+	Epoch(ctx context.Context) (int, error)
+	// ValidatorSet returns the ids of the validators in the current
+	// validator set.
+	ValidatorSet(ctx context.Context) ([]int, error)
+}
+
+// Blocks reads blocks from Ethereum.
+type Blocks interface {
+	Block(ctx context.Context, blockNumber string) (*types.Block, error)
+	// Head returns the number of the block referenced by tag: latest, safe
+	// or finalized.
+	Head(ctx context.Context, tag string) (uint64, error)
+	// HeadTime returns the timestamp of the latest block.
+	HeadTime(ctx context.Context) (time.Time, error)
+	// Receipt returns the receipt of the transaction with the given hash.
+	Receipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	// Logs returns the logs matching query.
+	Logs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// Runner runs external commands and returns their combined output.
+type Runner interface {
+	Run(name string, args ...string) ([]byte, error)
+}
+
+// ErrStakeUpdateNotIndexed is returned while the subgraph hasn't indexed the
+// requested nonce.
+var ErrStakeUpdateNotIndexed = errors.New("stake update not indexed by the subgraph yet")
+
+// ErrSignerChangeNotFound is returned when the subgraph has no signer change
+// for the requested nonce.
+var ErrSignerChangeNotFound = errors.New("no signer change for the nonce in the subgraph")
+
+// ErrValidatorExitNotFound is returned when the subgraph has no unstake
+// initiation for the requested nonce.
+var ErrValidatorExitNotFound = errors.New("no validator exit for the nonce in the subgraph")
+
+// ErrValidatorNotFound is returned when Heimdall has no validator with the
+// requested id.
+var ErrValidatorNotFound = errors.New("validator not found on Heimdall")
+
+// NewTransport returns the transport shared by every outbound HTTP client,
+// keeping connections alive across requests. Requests go through proxyURL
+// when set, an http, https or socks5 URL, and otherwise follow HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY.
+func NewTransport(proxyURL string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 16
+	transport.IdleConnTimeout = 90 * time.Second
+	if proxyURL == "" {
+		transport.Proxy = http.ProxyFromEnvironment
+		return transport, nil
+	}
+
+	proxy, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %v", err)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url %q: expected an http, https or socks5 URL", proxy.Redacted())
+	}
+	transport.Proxy = http.ProxyURL(proxy)
+	return transport, nil
+}
+
+// NewClientTLSConfig loads the client certificate presented for mutual TLS,
+// and when caFile is set the CA bundle the server is verified against
+// instead of the system roots.
+func NewClientTLSConfig(certFile string, keyFile string, caFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the client certificate: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return config, nil
+	}
+
+	bundle, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the CA bundle: %v", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no PEM certificates in the CA bundle %s", caFile)
+	}
+	return config, nil
+}
+
+// NewHTTPClient returns a client sending its requests through transport.
+func NewHTTPClient(timeout time.Duration, transport http.RoundTripper) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,236 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// EthBlocks reads blocks through an Ethereum JSON-RPC endpoint. It is safe
+// for concurrent use: a call failing on a dropped connection re-dials the
+// endpoint once, however many callers saw the failure, and is then retried
+// on the new connection.
+type EthBlocks struct {
+	url        string
+	httpClient *http.Client
+	// OnReconnect, when set, is called after every successful re-dial.
+	OnReconnect func()
+
+	// dialMu serializes re-dials.
+	dialMu sync.Mutex
+
+	mu         sync.Mutex
+	rpc        *rpc.Client
+	eth        *ethclient.Client
+	generation uint64
+}
+
+// DialEthBlocks connects to the JSON-RPC endpoint at url and checks that it
+// answers, since dialing an HTTP endpoint doesn't connect by itself. HTTP
+// endpoints are called through httpClient.
+func DialEthBlocks(ctx context.Context, url string, httpClient *http.Client) (*EthBlocks, error) {
+	b := &EthBlocks{url: url, httpClient: httpClient}
+	if err := b.dial(ctx); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *EthBlocks) dial(ctx context.Context) error {
+	var rpcClient *rpc.Client
+	var err error
+	if strings.HasPrefix(b.url, "http://") || strings.HasPrefix(b.url, "https://") {
+		rpcClient, err = rpc.DialHTTPWithClient(b.url, b.httpClient)
+	} else {
+		rpcClient, err = rpc.DialContext(ctx, b.url)
+	}
+	if err != nil {
+		return err
+	}
+	ethClient := ethclient.NewClient(rpcClient)
+	if _, err = ethClient.BlockNumber(ctx); err != nil {
+		rpcClient.Close()
+		return err
+	}
+
+	b.mu.Lock()
+	previous := b.rpc
+	b.rpc, b.eth = rpcClient, ethClient
+	b.generation++
+	b.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+func (b *EthBlocks) clients() (*rpc.Client, *ethclient.Client, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rpc, b.eth, b.generation
+}
+
+// call runs fn on the current connection. When it fails with a connection
+// error the endpoint is re-dialed and fn runs once more on the new
+// connection.
+func (b *EthBlocks) call(ctx context.Context, fn func(*rpc.Client, *ethclient.Client) error) error {
+	rpcClient, ethClient, generation := b.clients()
+	err := fn(rpcClient, ethClient)
+	if !isConnectionError(ctx, err) {
+		return err
+	}
+	slog.Warn("Ethereum RPC call failed, re-dialing", "err", err)
+	if dialErr := b.reconnect(ctx, generation); dialErr != nil {
+		slog.Warn("Unable to re-dial the Ethereum RPC", "err", dialErr)
+		return err
+	}
+	rpcClient, ethClient, _ = b.clients()
+	return fn(rpcClient, ethClient)
+}
+
+// reconnect re-dials unless another caller already replaced the connection
+// that failed, the one of the given generation.
+func (b *EthBlocks) reconnect(ctx context.Context, generation uint64) error {
+	b.dialMu.Lock()
+	defer b.dialMu.Unlock()
+	if _, _, current := b.clients(); current != generation {
+		return nil
+	}
+	if err := b.dial(ctx); err != nil {
+		return err
+	}
+	if b.OnReconnect != nil {
+		b.OnReconnect()
+	}
+	return nil
+}
+
+// isConnectionError tells whether err may be cured by re-dialing. Errors the
+// endpoint answered with, and the caller giving up, aren't.
+func isConnectionError(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(err, ethereum.NotFound) || ctx.Err() != nil {
+		return false
+	}
+	var rpcErr rpc.Error
+	var httpErr rpc.HTTPError
+	return !errors.As(err, &rpcErr) && !errors.As(err, &httpErr)
+}
+
+// Block returns the block with the given decimal number. Numbers that can't
+// be a real block, including ones past the chain head, are rejected before
+// the block is requested, so bad subgraph data never drives the RPC.
+func (b *EthBlocks) Block(ctx context.Context, blockNumber string) (*types.Block, error) {
+	number, err := parseBlockNumber(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := b.Head(ctx, "latest")
+	if err != nil {
+		return nil, err
+	}
+	if number > head {
+		return nil, fmt.Errorf("invalid block number %d: beyond the chain head %d", number, head)
+	}
+	var block *types.Block
+	err = b.call(ctx, func(_ *rpc.Client, ethClient *ethclient.Client) (err error) {
+		block, err = ethClient.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+		return err
+	})
+	return block, err
+}
+
+func parseBlockNumber(blockNumber string) (uint64, error) {
+	if blockNumber == "" {
+		return 0, errors.New("invalid block number: empty")
+	}
+	number, err := strconv.ParseUint(blockNumber, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block number %q: expected a positive decimal integer", blockNumber)
+	}
+	if number == 0 {
+		return 0, errors.New("invalid block number: stake-updates can't be in the genesis block")
+	}
+	return number, nil
+}
+
+func (b *EthBlocks) HeadTime(ctx context.Context) (time.Time, error) {
+	var head *types.Header
+	err := b.call(ctx, func(_ *rpc.Client, ethClient *ethclient.Client) (err error) {
+		head, err = ethClient.HeaderByNumber(ctx, nil)
+		return err
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(head.Time), 0), nil
+}
+
+func (b *EthBlocks) Receipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var receipt *types.Receipt
+	err := b.call(ctx, func(_ *rpc.Client, ethClient *ethclient.Client) (err error) {
+		receipt, err = ethClient.TransactionReceipt(ctx, txHash)
+		return err
+	})
+	return receipt, err
+}
+
+func (b *EthBlocks) Logs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := b.call(ctx, func(_ *rpc.Client, ethClient *ethclient.Client) (err error) {
+		logs, err = ethClient.FilterLogs(ctx, query)
+		return err
+	})
+	return logs, err
+}
+
+// ChainID returns the chain id of the endpoint.
+func (b *EthBlocks) ChainID(ctx context.Context) (int64, error) {
+	var chainId *big.Int
+	err := b.call(ctx, func(_ *rpc.Client, ethClient *ethclient.Client) (err error) {
+		chainId, err = ethClient.ChainID(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return chainId.Int64(), nil
+}
+
+func (b *EthBlocks) Head(ctx context.Context, tag string) (uint64, error) {
+	if tag == "latest" {
+		var head uint64
+		err := b.call(ctx, func(_ *rpc.Client, ethClient *ethclient.Client) (err error) {
+			head, err = ethClient.BlockNumber(ctx)
+			return err
+		})
+		return head, err
+	}
+
+	// go-ethereum's BlockByNumber has no safe tag, so ask for the header
+	// directly.
+	var head *types.Header
+	err := b.call(ctx, func(rpcClient *rpc.Client, _ *ethclient.Client) error {
+		return rpcClient.CallContext(ctx, &head, "eth_getBlockByNumber", tag, false)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if head == nil {
+		return 0, fmt.Errorf("RPC returned no %s block", tag)
+	}
+	return head.Number.Uint64(), nil
+}
@@ -0,0 +1,335 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultValidatorPath is the validator endpoint of Heimdall v1.
+const DefaultValidatorPath = "/staking/validator/{id}"
+
+// DefaultValidatorSetPath is the validator set endpoint of Heimdall v1.
+const DefaultValidatorSetPath = "/staking/validator-set"
+
+// notFoundError matches the error bodies Heimdall returns for an unknown
+// validator id.
+var notFoundError = regexp.MustCompile(`(?i)not found|no validator`)
+
+type ValidatorResponse struct {
+	Height string        `json:"height"`
+	Result ValidatorInfo `json:"result"`
+	Error  string        `json:"error"`
+}
+
+// ValidatorInfo is a Heimdall validator. Field names differ between Heimdall
+// versions, `ID` or `val_id`, `last_updated` or `lastUpdated`, and newer
+// ones encode 64-bit numbers as strings, so UnmarshalJSON matches names
+// regardless of case and underscores, and accepts the known aliases.
+type ValidatorInfo struct {
+	ID          int    `json:"ID"`
+	StartEpoch  int    `json:"startEpoch"`
+	EndEpoch    int    `json:"endEpoch"`
+	Nonce       int    `json:"nonce"`
+	Power       int    `json:"power"`
+	PubKey      string `json:"pubKey"`
+	Signer      string `json:"signer"`
+	LastUpdated string `json:"last_updated"`
+	Jailed      bool   `json:"jailed"`
+	Accum       int    `json:"accum"`
+}
+
+// validatorFields maps normalized field names of every known Heimdall
+// version to the ValidatorInfo field they fill.
+var validatorFields = map[string]string{
+	"id":               "id",
+	"valid":            "id",
+	"startepoch":       "startepoch",
+	"endepoch":         "endepoch",
+	"nonce":            "nonce",
+	"power":            "power",
+	"votingpower":      "power",
+	"pubkey":           "pubkey",
+	"signer":           "signer",
+	"lastupdated":      "lastupdated",
+	"jailed":           "jailed",
+	"accum":            "accum",
+	"proposerpriority": "accum",
+}
+
+// warnedShapes holds the unexpected validator shapes already warned about,
+// so a poll loop logs each one once.
+var warnedShapes sync.Map
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+func (v *ValidatorInfo) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+	var unknown []string
+	for name, value := range raw {
+		field, ok := validatorFields[normalizeFieldName(name)]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		fields[field] = value
+	}
+
+	var decoded ValidatorInfo
+	numbers := map[string]*int{
+		"id": &decoded.ID, "startepoch": &decoded.StartEpoch, "endepoch": &decoded.EndEpoch,
+		"nonce": &decoded.Nonce, "power": &decoded.Power, "accum": &decoded.Accum,
+	}
+	for field, target := range numbers {
+		value, ok := fields[field]
+		if !ok {
+			continue
+		}
+		var number flexInt
+		if err := json.Unmarshal(value, &number); err != nil {
+			return fmt.Errorf("invalid validator %s: %v", field, err)
+		}
+		*target = int(number)
+	}
+	others := map[string]interface{}{
+		"pubkey": &decoded.PubKey, "signer": &decoded.Signer,
+		"lastupdated": &decoded.LastUpdated, "jailed": &decoded.Jailed,
+	}
+	for field, target := range others {
+		if value, ok := fields[field]; ok {
+			if err := json.Unmarshal(value, target); err != nil {
+				return fmt.Errorf("invalid validator %s: %v", field, err)
+			}
+		}
+	}
+
+	_, hasNonce := fields["nonce"]
+	if len(raw) > 0 && (!hasNonce || len(unknown) > 0) {
+		warnValidatorShape(raw, hasNonce, unknown)
+	}
+	*v = decoded
+	return nil
+}
+
+// warnValidatorShape warns once per shape about validator responses without
+// a nonce, which then reads as zero, or with fields of no known version.
+func warnValidatorShape(raw map[string]json.RawMessage, hasNonce bool, unknown []string) {
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Strings(unknown)
+	if _, warned := warnedShapes.LoadOrStore(strings.Join(names, ","), true); warned {
+		return
+	}
+	if !hasNonce {
+		slog.Warn("Heimdall validator response has no nonce field, reading it as 0", "fields", strings.Join(names, ","))
+	}
+	if len(unknown) > 0 {
+		slog.Warn("Heimdall validator response has unknown fields, the Heimdall version may be unsupported", "unknown", strings.Join(unknown, ","))
+	}
+}
+
+// validatorEnvelope decodes either response shape. The v1 `result` key is
+// matched case-insensitively by encoding/json, so `Result` works as well.
+type validatorEnvelope struct {
+	ValidatorResponse
+	Validator *ValidatorInfo `json:"validator"`
+	// Code and Message carry gRPC gateway errors such as not found.
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type CheckpointCountResponse struct {
+	Height string `json:"height"`
+	Result struct {
+		Result int `json:"result"`
+	} `json:"result"`
+	// AckCount is the checkpoint count of newer Heimdall versions.
+	AckCount flexInt `json:"ack_count"`
+}
+
+// RESTHeimdall reads from the Heimdall REST API at URL.
+type RESTHeimdall struct {
+	URL    string
+	Client *http.Client
+	// ValidatorPath is the validator endpoint, with {id} replaced by the
+	// validator id. Defaults to DefaultValidatorPath.
+	ValidatorPath string
+	// ValidatorSetPath is the validator set endpoint. Defaults to
+	// DefaultValidatorSetPath.
+	ValidatorSetPath string
+}
+
+func (h *RESTHeimdall) Validator(ctx context.Context, validatorId int) (*ValidatorResponse, error) {
+	path := h.ValidatorPath
+	if path == "" {
+		path = DefaultValidatorPath
+	}
+	requestUrl := h.URL + strings.ReplaceAll(path, "{id}", strconv.Itoa(validatorId))
+
+	var envelope validatorEnvelope
+	err := h.get(ctx, requestUrl, &envelope)
+	var statusErr *httpStatusError
+	// Heimdall v1 answers an unknown id with an error status and a JSON
+	// error body, newer versions with a 404 and a gRPC gateway error. Any
+	// other error page, e.g. the 404 of a wrong path or of a proxy, is a
+	// failure rather than a validator Heimdall doesn't know yet.
+	if errors.As(err, &statusErr) && statusErr.HeimdallError && (statusErr.StatusCode == http.StatusNotFound || notFoundError.MatchString(statusErr.Message)) {
+		return nil, fmt.Errorf("%w: %v", ErrValidatorNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	responseData := envelope.ValidatorResponse
+	if envelope.Validator != nil {
+		responseData.Result = *envelope.Validator
+	} else if responseData.Error == "" && envelope.Code != 0 {
+		responseData.Error = envelope.Message
+	}
+
+	if responseData.Error != "" {
+		if notFoundError.MatchString(responseData.Error) {
+			return nil, fmt.Errorf("%w: %s", ErrValidatorNotFound, responseData.Error)
+		}
+		return nil, fmt.Errorf("heimdall error: %s", responseData.Error)
+	}
+	return &responseData, nil
+}
+
+func (h *RESTHeimdall) ValidatorSet(ctx context.Context) ([]int, error) {
+	path := h.ValidatorSetPath
+	if path == "" {
+		path = DefaultValidatorSetPath
+	}
+	var responseData struct {
+		Result struct {
+			Validators []ValidatorInfo `json:"validators"`
+		} `json:"result"`
+		// ValidatorSet is the shape of newer Heimdall versions.
+		ValidatorSet struct {
+			Validators []ValidatorInfo `json:"validators"`
+		} `json:"validator_set"`
+	}
+	if err := h.get(ctx, h.URL+path, &responseData); err != nil {
+		return nil, err
+	}
+
+	validators := responseData.Result.Validators
+	if len(validators) == 0 {
+		validators = responseData.ValidatorSet.Validators
+	}
+	ids := make([]int, 0, len(validators))
+	for _, validator := range validators {
+		ids = append(ids, validator.ID)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (h *RESTHeimdall) Epoch(ctx context.Context) (int, error) {
+	var responseData CheckpointCountResponse
+	if err := h.get(ctx, h.URL+"/checkpoints/count", &responseData); err != nil {
+		return 0, err
+	}
+	if responseData.AckCount != 0 {
+		return int(responseData.AckCount), nil
+	}
+	return responseData.Result.Result, nil
+}
+
+func (h *RESTHeimdall) get(ctx context.Context, requestUrl string, responseData interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
+	if err != nil {
+		return err
+	}
+	response, err := h.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, heimdallError := heimdallErrorMessage(data)
+		return &httpStatusError{StatusCode: response.StatusCode, Status: response.Status, Body: bodySnippet(data), Message: message, HeimdallError: heimdallError}
+	}
+
+	if err = json.Unmarshal(data, responseData); err != nil {
+		return fmt.Errorf("invalid heimdall response: %v", err)
+	}
+	return nil
+}
+
+// httpStatusError is a non-2xx Heimdall response.
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	// HeimdallError is set when the body is a Heimdall JSON error, whose
+	// message is Message.
+	HeimdallError bool
+	Message       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("heimdall returned %s: %s", e.Status, e.Body)
+}
+
+// heimdallErrorMessage returns the message of a Heimdall JSON error body:
+// {"error": ...} from Heimdall v1, {"code": ..., "message": ...} from the gRPC
+// gateway of newer versions. It returns false for any other body.
+func heimdallErrorMessage(data []byte) (string, bool) {
+	var body struct {
+		Error   string `json:"error"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", false
+	}
+	if body.Error != "" {
+		return body.Error, true
+	}
+	if body.Code != 0 {
+		return body.Message, true
+	}
+	return "", false
+}
+
+// flexInt decodes an integer given either as a JSON number or a string.
+type flexInt int64
+
+func (f *flexInt) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "" || value == "null" {
+		*f = 0
+		return nil
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+	*f = flexInt(number)
+	return nil
+}
@@ -0,0 +1,146 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestHeimdall returns a RESTHeimdall whose server answers every request
+// with status and body.
+func newTestHeimdall(t *testing.T, status int, body string) *RESTHeimdall {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return &RESTHeimdall{URL: server.URL, Client: server.Client()}
+}
+
+func TestValidatorNotFoundErrorBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "v1 error field", status: http.StatusOK, body: `{"height":"0","result":{},"error":"Validator not found"}`},
+		{name: "v1 error status", status: http.StatusInternalServerError, body: `{"error":"No validator with id 7"}`},
+		{name: "grpc gateway", status: http.StatusOK, body: `{"code":5,"message":"validator not found"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			heimdall := newTestHeimdall(t, test.status, test.body)
+			_, err := heimdall.Validator(context.Background(), 7)
+			if !errors.Is(err, ErrValidatorNotFound) {
+				t.Errorf("Validator = %v, want ErrValidatorNotFound", err)
+			}
+		})
+	}
+}
+
+func TestValidatorOtherErrorBody(t *testing.T) {
+	heimdall := newTestHeimdall(t, http.StatusOK, `{"error":"internal: codespace staking"}`)
+	_, err := heimdall.Validator(context.Background(), 7)
+	if err == nil || errors.Is(err, ErrValidatorNotFound) {
+		t.Errorf("Validator = %v, want an error other than ErrValidatorNotFound", err)
+	}
+}
+
+func TestValidatorStatus(t *testing.T) {
+	t.Run("200", func(t *testing.T) {
+		heimdall := newTestHeimdall(t, http.StatusOK, `{"height":"1","result":{"ID":7,"nonce":3}}`)
+		validator, err := heimdall.Validator(context.Background(), 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if validator.Result.Nonce != 3 {
+			t.Errorf("nonce %d, want 3", validator.Result.Nonce)
+		}
+	})
+	t.Run("404", func(t *testing.T) {
+		heimdall := newTestHeimdall(t, http.StatusNotFound, `{"code":5,"message":"validator does not exist","details":[]}`)
+		_, err := heimdall.Validator(context.Background(), 7)
+		if !errors.Is(err, ErrValidatorNotFound) {
+			t.Errorf("Validator = %v, want ErrValidatorNotFound", err)
+		}
+	})
+	t.Run("404 HTML page", func(t *testing.T) {
+		heimdall := newTestHeimdall(t, http.StatusNotFound, "<html><body><h1>404 Not Found</h1>nginx</body></html>")
+		_, err := heimdall.Validator(context.Background(), 7)
+		if err == nil || errors.Is(err, ErrValidatorNotFound) {
+			t.Fatalf("Validator = %v, want an error other than ErrValidatorNotFound", err)
+		}
+		if !strings.Contains(err.Error(), "heimdall returned 404") {
+			t.Errorf("Validator = %v, want the status", err)
+		}
+	})
+	t.Run("404 plain text", func(t *testing.T) {
+		heimdall := newTestHeimdall(t, http.StatusNotFound, "404 page not found")
+		if _, err := heimdall.Validator(context.Background(), 7); err == nil || errors.Is(err, ErrValidatorNotFound) {
+			t.Errorf("Validator = %v, want an error other than ErrValidatorNotFound", err)
+		}
+	})
+	t.Run("500", func(t *testing.T) {
+		heimdall := newTestHeimdall(t, http.StatusInternalServerError, "<html><body>Internal Server Error</body></html>")
+		_, err := heimdall.Validator(context.Background(), 7)
+		if err == nil || errors.Is(err, ErrValidatorNotFound) {
+			t.Fatalf("Validator = %v, want an error other than ErrValidatorNotFound", err)
+		}
+		if !strings.Contains(err.Error(), "heimdall returned 500") || !strings.Contains(err.Error(), "Internal Server Error") {
+			t.Errorf("Validator = %v, want the status and a body snippet", err)
+		}
+	})
+}
+
+func TestValidatorResponseShapes(t *testing.T) {
+	want := ValidatorInfo{
+		ID:          7,
+		StartEpoch:  10,
+		EndEpoch:    20,
+		Nonce:       3,
+		Power:       100,
+		PubKey:      "0x04ab",
+		Signer:      "0xcd",
+		LastUpdated: "3200",
+		Jailed:      true,
+		Accum:       -5,
+	}
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "v1",
+			body: `{"height":"123","result":{"ID":7,"startEpoch":10,"endEpoch":20,"nonce":3,"power":100,"pubKey":"0x04ab","signer":"0xcd","last_updated":"3200","jailed":true,"accum":-5}}`,
+		},
+		{
+			name: "v1 capitalised result",
+			body: `{"height":"123","Result":{"ID":7,"startEpoch":10,"endEpoch":20,"nonce":3,"power":100,"pubKey":"0x04ab","signer":"0xcd","last_updated":"3200","jailed":true,"accum":-5}}`,
+		},
+		{
+			name: "v1 camel case",
+			body: `{"height":"123","result":{"id":7,"startEpoch":10,"endEpoch":20,"nonce":3,"power":100,"pubKey":"0x04ab","signer":"0xcd","lastUpdated":"3200","jailed":true,"accum":-5}}`,
+		},
+		{
+			name: "v2",
+			body: `{"validator":{"val_id":"7","start_epoch":"10","end_epoch":"20","nonce":"3","voting_power":"100","pub_key":"0x04ab","signer":"0xcd","last_updated":"3200","jailed":true,"proposer_priority":"-5"}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			heimdall := newTestHeimdall(t, http.StatusOK, test.body)
+			validator, err := heimdall.Validator(context.Background(), 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if validator.Result != want {
+				t.Errorf("decoded %+v, want %+v", validator.Result, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package clients
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PayloadLogger is a transport logging the body of every request and
+// response at debug level, cut to MaxBytes. Credential headers are logged
+// as ***.
+type PayloadLogger struct {
+	Next     http.RoundTripper
+	Service  string
+	MaxBytes int
+}
+
+func (l *PayloadLogger) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !slog.Default().Enabled(request.Context(), slog.LevelDebug) {
+		return l.Next.RoundTrip(request)
+	}
+
+	var requestBody []byte
+	if request.Body != nil {
+		var err error
+		requestBody, err = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+	logger := slog.With("service", l.Service, "method", request.Method, "url", RedactURL(request.URL.String()))
+	logger.Debug("HTTP request", "headers", redactHeaders(request.Header), "body", l.truncate(requestBody))
+
+	response, err := l.Next.RoundTrip(request)
+	if err != nil {
+		logger.Debug("HTTP request failed", "err", err)
+		return nil, err
+	}
+	responseBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(responseBody), errorReader{err}))
+	logger.Debug("HTTP response", "status", response.Status, "body", l.truncate(responseBody))
+	return response, nil
+}
+
+func (l *PayloadLogger) truncate(body []byte) string {
+	if l.MaxBytes > 0 && len(body) > l.MaxBytes {
+		return string(body[:l.MaxBytes]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+// errorReader replays a read error after the buffered body.
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+// sensitiveHeader matches header names whose values may be credentials.
+var sensitiveHeader = regexp.MustCompile(`(?i)auth|cookie|key|token|secret`)
+
+func redactHeaders(header http.Header) map[string]string {
+	redacted := map[string]string{}
+	for name, values := range header {
+		if sensitiveHeader.MatchString(name) {
+			redacted[name] = "***"
+		} else {
+			redacted[name] = strings.Join(values, ",")
+		}
+	}
+	return redacted
+}
+
+// secretPathSegment matches path segments that look like API keys, such as
+// the one gateway URLs embed in /api/<key>/subgraphs/id/...
+var secretPathSegment = regexp.MustCompile(`^(?i)[0-9a-f]{32,}$`)
+
+// RedactURL drops credentials and the query string from rawUrl and masks
+// path segments that look like API keys.
+func RedactURL(rawUrl string) string {
+	if rawUrl == "" {
+		return ""
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || parsed.Host == "" {
+		return "***"
+	}
+	segments := strings.Split(parsed.Path, "/")
+	for i, segment := range segments {
+		if secretPathSegment.MatchString(segment) {
+			segments[i] = "***"
+		}
+	}
+	redactedUrl := parsed.Scheme + "://" + parsed.Host + strings.Join(segments, "/")
+	if parsed.RawQuery != "" {
+		redactedUrl += "?***"
+	}
+	return redactedUrl
+}
@@ -0,0 +1,32 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// ExecRunner runs commands as child processes, killing them after Timeout.
+// It is deliberately not bound to any caller context, so a command under way
+// at shutdown completes.
+type ExecRunner struct {
+	Timeout time.Duration
+}
+
+// Run returns the combined output of the command. When the command is killed
+// for running over Timeout, the error wraps context.DeadlineExceeded.
+func (r *ExecRunner) Run(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	// Stop waiting for the output pipes shortly after the kill, in case a
+	// child of the command still holds them open.
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("killed after %s: %w", r.Timeout, context.DeadlineExceeded)
+	}
+	return output, err
+}
@@ -0,0 +1,829 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type StakeUpdate struct {
+	ID              string `json:"id"`
+	ValidatorID     string `json:"validatorId"`
+	TotalStaked     string `json:"totalStaked"`
+	Block           string `json:"block"`
+	Nonce           string `json:"nonce"`
+	TransactionHash string `json:"transactionHash"`
+	LogIndex        string `json:"logIndex"`
+}
+
+// StakedAmount parses TotalStaked, a wei amount far beyond the int64 range.
+func (u StakeUpdate) StakedAmount() (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(u.TotalStaked, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("invalid staked amount %q", u.TotalStaked)
+	}
+	return amount, nil
+}
+
+var txHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// Validate checks that every field passed on to Heimdall is well-formed,
+// naming the first one that isn't, so malformed subgraph data fails here
+// rather than as an opaque heimdallcli error.
+func (u StakeUpdate) Validate() error {
+	if _, err := strconv.ParseUint(u.ValidatorID, 10, 64); err != nil {
+		return invalidField("validatorId", u.ValidatorID, "a non-negative integer")
+	}
+	if block, err := strconv.ParseUint(u.Block, 10, 64); err != nil || block == 0 {
+		return invalidField("block", u.Block, "a positive integer")
+	}
+	if _, err := parseNonce(u.Nonce); err != nil {
+		return invalidField("nonce", u.Nonce, "a non-negative integer")
+	}
+	if _, err := strconv.ParseUint(u.LogIndex, 10, 64); err != nil {
+		return invalidField("logIndex", u.LogIndex, "a non-negative integer")
+	}
+	if _, err := u.StakedAmount(); err != nil {
+		return invalidField("totalStaked", u.TotalStaked, "a non-negative integer")
+	}
+	if !txHashPattern.MatchString(u.TransactionHash) {
+		return invalidField("transactionHash", u.TransactionHash, "a 0x-prefixed 32 byte hex hash")
+	}
+	return nil
+}
+
+func invalidField(name string, value string, expected string) error {
+	return fmt.Errorf("invalid stake-update field %s %q: expected %s", name, value, expected)
+}
+
+// parseNonce parses a nonce returned by the subgraph, which encodes BigInt
+// fields as decimal strings.
+func parseNonce(value string) (int, error) {
+	nonce, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || nonce < 0 {
+		return 0, fmt.Errorf("invalid nonce %q from the subgraph", value)
+	}
+	if int64(int(nonce)) != nonce {
+		return 0, fmt.Errorf("nonce %d from the subgraph overflows int", nonce)
+	}
+	return int(nonce), nil
+}
+
+// SignerChange is a validator's signer change on Ethereum. It takes a
+// validator nonce like a stake-update, and is relayed to Heimdall with a
+// signer-update.
+type SignerChange struct {
+	ID              string `json:"id"`
+	ValidatorID     string `json:"validatorId"`
+	NewSigner       string `json:"newSigner"`
+	SignerPubKey    string `json:"signerPubKey"`
+	Block           string `json:"block"`
+	Nonce           string `json:"nonce"`
+	TransactionHash string `json:"transactionHash"`
+	LogIndex        string `json:"logIndex"`
+}
+
+// pubKeyPattern matches a 64 byte public key, or a 65 byte one with its
+// format prefix.
+var pubKeyPattern = regexp.MustCompile(`^0x([0-9a-fA-F]{2})?[0-9a-fA-F]{128}$`)
+
+// Validate checks the fields passed on to Heimdall like StakeUpdate.Validate.
+func (c SignerChange) Validate() error {
+	if _, err := strconv.ParseUint(c.ValidatorID, 10, 64); err != nil {
+		return invalidSignerChangeField("validatorId", c.ValidatorID, "a non-negative integer")
+	}
+	if block, err := strconv.ParseUint(c.Block, 10, 64); err != nil || block == 0 {
+		return invalidSignerChangeField("block", c.Block, "a positive integer")
+	}
+	if _, err := parseNonce(c.Nonce); err != nil {
+		return invalidSignerChangeField("nonce", c.Nonce, "a non-negative integer")
+	}
+	if _, err := strconv.ParseUint(c.LogIndex, 10, 64); err != nil {
+		return invalidSignerChangeField("logIndex", c.LogIndex, "a non-negative integer")
+	}
+	if !pubKeyPattern.MatchString(c.SignerPubKey) {
+		return invalidSignerChangeField("signerPubKey", c.SignerPubKey, "a 0x-prefixed 64 or 65 byte hex public key")
+	}
+	if !txHashPattern.MatchString(c.TransactionHash) {
+		return invalidSignerChangeField("transactionHash", c.TransactionHash, "a 0x-prefixed 32 byte hex hash")
+	}
+	return nil
+}
+
+func invalidSignerChangeField(name string, value string, expected string) error {
+	return fmt.Errorf("invalid signer-change field %s %q: expected %s", name, value, expected)
+}
+
+// ValidatorExit is a validator's unstake initiation on Ethereum
+// (UnstakeInit), which takes a validator nonce as well and is relayed to
+// Heimdall with a validator-exit.
+type ValidatorExit struct {
+	ID                string `json:"id"`
+	ValidatorID       string `json:"validatorId"`
+	DeactivationEpoch string `json:"deactivationEpoch"`
+	Block             string `json:"block"`
+	Nonce             string `json:"nonce"`
+	TransactionHash   string `json:"transactionHash"`
+	LogIndex          string `json:"logIndex"`
+}
+
+// Validate checks the fields passed on to Heimdall like StakeUpdate.Validate.
+func (e ValidatorExit) Validate() error {
+	if _, err := strconv.ParseUint(e.ValidatorID, 10, 64); err != nil {
+		return invalidValidatorExitField("validatorId", e.ValidatorID, "a non-negative integer")
+	}
+	if epoch, err := strconv.ParseUint(e.DeactivationEpoch, 10, 64); err != nil || epoch == 0 {
+		return invalidValidatorExitField("deactivationEpoch", e.DeactivationEpoch, "a positive integer")
+	}
+	if block, err := strconv.ParseUint(e.Block, 10, 64); err != nil || block == 0 {
+		return invalidValidatorExitField("block", e.Block, "a positive integer")
+	}
+	if _, err := parseNonce(e.Nonce); err != nil {
+		return invalidValidatorExitField("nonce", e.Nonce, "a non-negative integer")
+	}
+	if _, err := strconv.ParseUint(e.LogIndex, 10, 64); err != nil {
+		return invalidValidatorExitField("logIndex", e.LogIndex, "a non-negative integer")
+	}
+	if !txHashPattern.MatchString(e.TransactionHash) {
+		return invalidValidatorExitField("transactionHash", e.TransactionHash, "a 0x-prefixed 32 byte hex hash")
+	}
+	return nil
+}
+
+func invalidValidatorExitField(name string, value string, expected string) error {
+	return fmt.Errorf("invalid validator-exit field %s %q: expected %s", name, value, expected)
+}
+
+type SignerChangeResponse struct {
+	Data struct {
+		SignerChanges []SignerChange `json:"signerChanges"`
+	} `json:"data"`
+	Errors []GraphQLError `json:"errors"`
+}
+
+type ValidatorExitResponse struct {
+	Data struct {
+		UnstakeInits []ValidatorExit `json:"unstakeInits"`
+	} `json:"data"`
+	Errors []GraphQLError `json:"errors"`
+}
+
+type StakeUpdateResponse struct {
+	Data struct {
+		StakeUpdates []StakeUpdate `json:"stakeUpdates"`
+	} `json:"data"`
+	Errors []GraphQLError `json:"errors"`
+}
+
+// GraphQLError is an entry of the standard GraphQL `errors` array.
+type GraphQLError struct {
+	Message string `json:"message"`
+}
+
+// graphQLErrors turns a non-empty `errors` array into a Go error carrying the
+// first message.
+func graphQLErrors(errs []GraphQLError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) == 1 {
+		return fmt.Errorf("subgraph error: %s", errs[0].Message)
+	}
+	return fmt.Errorf("subgraph error: %s (and %d more)", errs[0].Message, len(errs)-1)
+}
+
+// HTTPSubgraph queries a GraphQL subgraph over HTTP. When several URLs are
+// given they are tried in turn, starting with the last one that worked.
+type HTTPSubgraph struct {
+	URLs   []string
+	Client *http.Client
+	// APIKey, when set, is sent as a bearer token.
+	APIKey string
+	// Headers are extra headers sent with every query, taking precedence
+	// over the ones set above.
+	Headers map[string]string
+	// Limiter, when set, gates every request. Throttled requests wait for
+	// it, calling OnThrottled first.
+	Limiter     *rate.Limiter
+	OnThrottled func()
+	// MaxResults is how many matches a stake-update query asks for, so
+	// duplicates of a nonce are noticed. Defaults to DefaultMaxResults.
+	MaxResults int
+	// PageSize and MaxPages bound paginated queries, defaulting to
+	// DefaultPageSize and DefaultMaxPages.
+	PageSize int
+	MaxPages int
+	// LatestOrderBy and LatestOrderDirection order the events of latest-nonce
+	// queries, defaulting to DefaultLatestOrderBy and
+	// DefaultLatestOrderDirection.
+	LatestOrderBy        string
+	LatestOrderDirection string
+
+	mu        sync.Mutex
+	preferred int
+}
+
+// DefaultMaxResults is the default of HTTPSubgraph.MaxResults.
+const DefaultMaxResults = 5
+
+const (
+	// DefaultPageSize is the most results graph-node returns at once.
+	DefaultPageSize = 1000
+	DefaultMaxPages = 100
+)
+
+const (
+	// DefaultLatestOrderBy and DefaultLatestOrderDirection put the highest
+	// nonce first.
+	DefaultLatestOrderBy        = "nonce"
+	DefaultLatestOrderDirection = "desc"
+)
+
+func (s *HTTPSubgraph) LatestNonce(ctx context.Context, validatorId int) (int, error) {
+	var response latestNonceResponse
+	orderBy, orderDirection := s.latestOrder()
+	if err := s.query(ctx, getLatestNonceQuery(validatorId, orderBy, orderDirection), &response); err != nil {
+		return 0, err
+	}
+
+	nonce, _, err := s.latestNonce(ctx, validatorId, response.Data)
+	return nonce, err
+}
+
+// LatestNonces runs one aliased latest-nonce query per validator within a
+// single GraphQL request. Unlike a single validatorId_in filter this can't be
+// cut short by the page size when a validator has many stake-updates.
+func (s *HTTPSubgraph) LatestNonces(ctx context.Context, validatorIds []int) (map[int]int, error) {
+	var response latestNonceResponse
+	orderBy, orderDirection := s.latestOrder()
+	if err := s.query(ctx, getLatestNoncesQuery(validatorIds, orderBy, orderDirection), &response); err != nil {
+		return nil, err
+	}
+
+	nonces := map[int]int{}
+	for _, validatorId := range validatorIds {
+		nonce, ok, err := s.latestNonce(ctx, validatorId, response.Data)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			nonces[validatorId] = nonce
+		}
+	}
+	return nonces, nil
+}
+
+// latestNonceResponse holds the selections of latest-nonce queries by alias.
+// Only the nonce, block and log index are asked for, so signer changes and
+// unstakes decode as stake-updates too.
+type latestNonceResponse struct {
+	Data map[string][]StakeUpdate `json:"data"`
+}
+
+// latestOrder returns the order of latest-nonce queries.
+func (s *HTTPSubgraph) latestOrder() (orderBy string, orderDirection string) {
+	orderBy, orderDirection = s.LatestOrderBy, s.LatestOrderDirection
+	if orderBy == "" {
+		orderBy = DefaultLatestOrderBy
+	}
+	if orderDirection == "" {
+		orderDirection = DefaultLatestOrderDirection
+	}
+	return orderBy, orderDirection
+}
+
+// latestNonce returns the validator's highest nonce among its latest
+// stake-update, signer change and unstake, false when it has none of them.
+// When several stake-updates share the highest nonce, every one of them is
+// fetched so latestStakeUpdate picks among all of them.
+func (s *HTTPSubgraph) latestNonce(ctx context.Context, validatorId int, data map[string][]StakeUpdate) (int, bool, error) {
+	stakeUpdates := data[nonceAlias(validatorId)]
+	if nonce, tied := tiedLatestNonce(stakeUpdates); tied {
+		tiedStakeUpdates, err := s.paginate(ctx, func(first int, afterId string) []byte {
+			return getStakeUpdatesOfNonceQuery(validatorId, nonce, first, afterId)
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		// The subgraph may have reindexed in between, keeping what the
+		// first query returned.
+		if len(tiedStakeUpdates) > 0 {
+			stakeUpdates = tiedStakeUpdates
+		}
+	}
+
+	latest, found := 0, false
+	candidates := append([]StakeUpdate{}, data[signerChangeAlias(validatorId)]...)
+	candidates = append(candidates, data[unstakeInitAlias(validatorId)]...)
+	if stakeUpdate, ok := latestStakeUpdate(validatorId, stakeUpdates); ok {
+		candidates = append(candidates, stakeUpdate)
+	}
+	for _, candidate := range candidates {
+		nonce, err := parseNonce(candidate.Nonce)
+		if err != nil {
+			return 0, false, err
+		}
+		if !found || nonce > latest {
+			latest, found = nonce, true
+		}
+	}
+	return latest, found, nil
+}
+
+// latestNonceCandidates is how many stake-updates a latest-nonce query asks
+// for, enough to notice two sharing the highest nonce.
+const latestNonceCandidates = 2
+
+// tiedLatestNonce returns the highest nonce of stakeUpdates, true when more
+// than one of them has it. Nonces that don't parse are left to latestNonce
+// to report.
+func tiedLatestNonce(stakeUpdates []StakeUpdate) (int, bool) {
+	latest, count := 0, 0
+	for _, stakeUpdate := range stakeUpdates {
+		nonce, err := parseNonce(stakeUpdate.Nonce)
+		if err != nil {
+			continue
+		}
+		switch {
+		case count == 0 || nonce > latest:
+			latest, count = nonce, 1
+		case nonce == latest:
+			count++
+		}
+	}
+	return latest, count > 1
+}
+
+// latestStakeUpdate picks the latest of the stake-updates of a latest-nonce
+// query. graph-node orders by a single field, so ties on the nonce, which a
+// reorg can leave behind, are broken here by block, then log index, the
+// latest winning, keeping the choice deterministic whatever the order of the
+// query.
+func latestStakeUpdate(validatorId int, stakeUpdates []StakeUpdate) (StakeUpdate, bool) {
+	if len(stakeUpdates) == 0 {
+		return StakeUpdate{}, false
+	}
+	sorted := append([]StakeUpdate{}, stakeUpdates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareLatest(sorted[i], sorted[j]) > 0
+	})
+	if len(sorted) > 1 && sorted[0].Nonce == sorted[1].Nonce {
+		slog.Warn("Subgraph returned several stake-updates for the latest nonce",
+			"validator_id", validatorId, "nonce", sorted[0].Nonce, "matches", len(sorted), "block", sorted[0].Block, "other_block", sorted[1].Block)
+	}
+	return sorted[0], true
+}
+
+// compareLatest orders stake-updates by nonce, block, then log index, all
+// compared numerically.
+func compareLatest(a StakeUpdate, b StakeUpdate) int {
+	for _, pair := range [][2]string{{a.Nonce, b.Nonce}, {a.Block, b.Block}, {a.LogIndex, b.LogIndex}} {
+		x, _ := new(big.Int).SetString(pair[0], 10)
+		y, _ := new(big.Int).SetString(pair[1], 10)
+		if x == nil || y == nil {
+			continue
+		}
+		if c := x.Cmp(y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (s *HTTPSubgraph) StakeUpdate(ctx context.Context, validatorId int, nonce int) (StakeUpdate, error) {
+	maxResults := s.MaxResults
+	if maxResults <= 0 {
+		maxResults = DefaultMaxResults
+	}
+	var response StakeUpdateResponse
+	if err := s.query(ctx, getStakeUpdateQuery(validatorId, nonce, maxResults), &response); err != nil {
+		return StakeUpdate{}, err
+	}
+
+	if len(response.Data.StakeUpdates) == 0 {
+		return StakeUpdate{}, ErrStakeUpdateNotIndexed
+	}
+
+	// The latest block wins, the others are most likely left over from a
+	// reorg.
+	stakeUpdate := response.Data.StakeUpdates[0]
+	if matches := len(response.Data.StakeUpdates); matches > 1 {
+		others := make([]string, 0, matches-1)
+		for _, other := range response.Data.StakeUpdates[1:] {
+			others = append(others, other.ID)
+		}
+		slog.Warn("Subgraph returned several stake-updates for the nonce, using the latest block",
+			"validator_id", validatorId, "nonce", nonce, "matches", matches, "id", stakeUpdate.ID, "block", stakeUpdate.Block, "ignored", strings.Join(others, ","))
+	}
+	if err := stakeUpdate.Validate(); err != nil {
+		return StakeUpdate{}, err
+	}
+	return stakeUpdate, nil
+}
+
+func (s *HTTPSubgraph) SignerChange(ctx context.Context, validatorId int, nonce int) (SignerChange, error) {
+	var response SignerChangeResponse
+	if err := s.query(ctx, getSignerChangeQuery(validatorId, nonce), &response); err != nil {
+		return SignerChange{}, err
+	}
+	if len(response.Data.SignerChanges) == 0 {
+		return SignerChange{}, ErrSignerChangeNotFound
+	}
+
+	// As with stake-updates, the latest block wins.
+	signerChange := response.Data.SignerChanges[0]
+	if err := signerChange.Validate(); err != nil {
+		return SignerChange{}, err
+	}
+	return signerChange, nil
+}
+
+func (s *HTTPSubgraph) ValidatorExit(ctx context.Context, validatorId int, nonce int) (ValidatorExit, error) {
+	var response ValidatorExitResponse
+	if err := s.query(ctx, getValidatorExitQuery(validatorId, nonce), &response); err != nil {
+		return ValidatorExit{}, err
+	}
+	if len(response.Data.UnstakeInits) == 0 {
+		return ValidatorExit{}, ErrValidatorExitNotFound
+	}
+
+	validatorExit := response.Data.UnstakeInits[0]
+	if err := validatorExit.Validate(); err != nil {
+		return ValidatorExit{}, err
+	}
+	return validatorExit, nil
+}
+
+// MetaResponse is the `_meta` block every graph-node subgraph exposes.
+type MetaResponse struct {
+	Data struct {
+		Meta struct {
+			Block struct {
+				Number uint64 `json:"number"`
+			} `json:"block"`
+		} `json:"_meta"`
+	} `json:"data"`
+	Errors []GraphQLError `json:"errors"`
+}
+
+func (s *HTTPSubgraph) StakeUpdatesInRange(ctx context.Context, validatorId int, fromBlock uint64, toBlock uint64) ([]StakeUpdate, error) {
+	stakeUpdates, err := s.paginate(ctx, func(first int, afterId string) []byte {
+		return getStakeUpdatesInRangeQuery(validatorId, fromBlock, toBlock, first, afterId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, stakeUpdate := range stakeUpdates {
+		if err := stakeUpdate.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	// Pages come ordered by id, the cursor.
+	sort.SliceStable(stakeUpdates, func(i, j int) bool {
+		blockI, _ := strconv.ParseUint(stakeUpdates[i].Block, 10, 64)
+		blockJ, _ := strconv.ParseUint(stakeUpdates[j].Block, 10, 64)
+		if blockI != blockJ {
+			return blockI < blockJ
+		}
+		logIndexI, _ := strconv.ParseUint(stakeUpdates[i].LogIndex, 10, 64)
+		logIndexJ, _ := strconv.ParseUint(stakeUpdates[j].LogIndex, 10, 64)
+		return logIndexI < logIndexJ
+	})
+	return stakeUpdates, nil
+}
+
+// paginate runs the query built by page with an id_gt cursor, the id of the
+// last stake-update of the previous page, empty for the first one, until a
+// page has fewer than PageSize entries. Unlike skip, the cursor stays cheap
+// and consistent on large sets. More than MaxPages pages is an error rather
+// than an endless loop.
+func (s *HTTPSubgraph) paginate(ctx context.Context, page func(first int, afterId string) []byte) ([]StakeUpdate, error) {
+	pageSize := s.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	maxPages := s.MaxPages
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+
+	var stakeUpdates []StakeUpdate
+	afterId := ""
+	for pages := 1; ; pages++ {
+		var response StakeUpdateResponse
+		if err := s.query(ctx, page(pageSize, afterId), &response); err != nil {
+			return nil, err
+		}
+		results := response.Data.StakeUpdates
+		stakeUpdates = append(stakeUpdates, results...)
+		if len(results) < pageSize {
+			return stakeUpdates, nil
+		}
+		if pages >= maxPages {
+			return nil, fmt.Errorf("subgraph query has more than %d pages of %d results", maxPages, pageSize)
+		}
+		lastId := results[len(results)-1].ID
+		if lastId == "" || lastId == afterId {
+			return nil, fmt.Errorf("subgraph pagination cursor didn't advance past %q", afterId)
+		}
+		afterId = lastId
+	}
+}
+
+func (s *HTTPSubgraph) IndexedBlock(ctx context.Context) (uint64, error) {
+	var response MetaResponse
+	if err := s.query(ctx, getMetaQuery(), &response); err != nil {
+		return 0, err
+	}
+	return response.Data.Meta.Block.Number, nil
+}
+
+// query runs query against the endpoints until one answers without a
+// network error, non-2xx status or GraphQL error, and decodes the answer into
+// response. The endpoint that answered is tried first next time.
+func (s *HTTPSubgraph) query(ctx context.Context, query []byte, response interface{}) error {
+	s.mu.Lock()
+	start := s.preferred
+	s.mu.Unlock()
+
+	var err error
+	for i := range s.URLs {
+		index := (start + i) % len(s.URLs)
+		err = s.queryURL(ctx, s.URLs[index], query, response)
+		if err == nil {
+			if index != start {
+				slog.Info("Switched to subgraph endpoint", "endpoint", index)
+				s.mu.Lock()
+				s.preferred = index
+				s.mu.Unlock()
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if len(s.URLs) > 1 {
+			slog.Warn("Subgraph endpoint failed", "endpoint", index, "err", err)
+		}
+	}
+	if len(s.URLs) > 1 {
+		return fmt.Errorf("all %d subgraph endpoints failed, last error: %w", len(s.URLs), err)
+	}
+	return err
+}
+
+func (s *HTTPSubgraph) queryURL(ctx context.Context, url string, query []byte, response interface{}) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	data, err := s.post(ctx, url, query)
+	if err != nil {
+		return err
+	}
+
+	var errorsOnly struct {
+		Errors []GraphQLError `json:"errors"`
+	}
+	if err = json.Unmarshal(data, &errorsOnly); err != nil {
+		return fmt.Errorf("invalid subgraph response: %v", err)
+	}
+	if err = graphQLErrors(errorsOnly.Errors); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("invalid subgraph response: %v", err)
+	}
+	return nil
+}
+
+// wait blocks until the limiter allows another request.
+func (s *HTTPSubgraph) wait(ctx context.Context) error {
+	if s.Limiter == nil {
+		return nil
+	}
+	reservation := s.Limiter.Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if s.OnThrottled != nil {
+		s.OnThrottled()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+func (s *HTTPSubgraph) post(ctx context.Context, url string, query []byte) (data []byte, err error) {
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(query))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+	for name, value := range s.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("subgraph returned %s: %s", response.Status, bodySnippet(data))
+	}
+	return data, nil
+}
+
+// bodySnippet shortens a response body for inclusion in an error.
+func bodySnippet(data []byte) string {
+	const maxLen = 200
+	snippet := strings.TrimSpace(string(data))
+	if len(snippet) > maxLen {
+		snippet = snippet[:maxLen] + "..."
+	}
+	return snippet
+}
+
+// latestNonceSelection is the selection of latest-nonce queries. Signer
+// changes and unstakes take validator nonces like stake-updates, so the
+// newest of each is asked for as well, and the highest nonce of the three
+// wins. All three are ordered by orderBy in orderDirection, and
+// stake-updates return what latestStakeUpdate breaks ties with.
+func latestNonceSelection(validatorId int, orderBy string, orderDirection string) string {
+	return fmt.Sprintf("%s: stakeUpdates(first: %d, orderBy: %s, orderDirection: %s, where: {validatorId: %d}){ nonce block logIndex } ", nonceAlias(validatorId), latestNonceCandidates, orderBy, orderDirection, validatorId) +
+		fmt.Sprintf("%s: signerChanges(first: 1, orderBy: %s, orderDirection: %s, where: {validatorId: %d}){ nonce } ", signerChangeAlias(validatorId), orderBy, orderDirection, validatorId) +
+		fmt.Sprintf("%s: unstakeInits(first: 1, orderBy: %s, orderDirection: %s, where: {validatorId: %d}){ nonce }", unstakeInitAlias(validatorId), orderBy, orderDirection, validatorId)
+}
+
+func getLatestNonceQuery(validatorId int, orderBy string, orderDirection string) []byte {
+	return getLatestNoncesQuery([]int{validatorId}, orderBy, orderDirection)
+}
+
+func getStakeUpdateQuery(validatorId int, nonce int, maxResults int) []byte {
+	query := map[string]string{
+		"query": `
+		{
+			stakeUpdates(first: ` + strconv.Itoa(maxResults) + `, orderBy: block, orderDirection: desc, where: {validatorId: ` + strconv.Itoa(validatorId) + `, nonce: ` + strconv.Itoa(nonce) + `}){
+				id
+				validatorId
+				totalStaked
+				block
+				nonce
+				transactionHash
+				logIndex
+		   } 
+		}   
+		`,
+	}
+
+	byteQuery, _ := json.Marshal(query)
+	return byteQuery
+}
+
+func getSignerChangeQuery(validatorId int, nonce int) []byte {
+	query := map[string]string{
+		"query": fmt.Sprintf(`
+		{
+			signerChanges(first: 1, orderBy: block, orderDirection: desc, where: {validatorId: %d, nonce: %d}){
+				id
+				validatorId
+				newSigner
+				signerPubKey
+				block
+				nonce
+				transactionHash
+				logIndex
+		   }
+		}
+		`, validatorId, nonce),
+	}
+
+	byteQuery, _ := json.Marshal(query)
+	return byteQuery
+}
+
+func getValidatorExitQuery(validatorId int, nonce int) []byte {
+	query := map[string]string{
+		"query": fmt.Sprintf(`
+		{
+			unstakeInits(first: 1, orderBy: block, orderDirection: desc, where: {validatorId: %d, nonce: %d}){
+				id
+				validatorId
+				deactivationEpoch
+				block
+				nonce
+				transactionHash
+				logIndex
+		   }
+		}
+		`, validatorId, nonce),
+	}
+
+	byteQuery, _ := json.Marshal(query)
+	return byteQuery
+}
+
+func getStakeUpdatesInRangeQuery(validatorId int, fromBlock uint64, toBlock uint64, first int, afterId string) []byte {
+	idJSON, _ := json.Marshal(afterId)
+	query := map[string]string{
+		"query": fmt.Sprintf(`
+		{
+			stakeUpdates(first: %d, orderBy: id, orderDirection: asc, where: {validatorId: %d, block_gte: %d, block_lte: %d, id_gt: %s}){
+				id
+				validatorId
+				totalStaked
+				block
+				nonce
+				transactionHash
+				logIndex
+		   }
+		}
+		`, first, validatorId, fromBlock, toBlock, idJSON),
+	}
+
+	byteQuery, _ := json.Marshal(query)
+	return byteQuery
+}
+
+// getStakeUpdatesOfNonceQuery pages through every stake-update of the
+// validator with the given nonce, for breaking a tie on the latest nonce.
+func getStakeUpdatesOfNonceQuery(validatorId int, nonce int, first int, afterId string) []byte {
+	idJSON, _ := json.Marshal(afterId)
+	query := map[string]string{
+		"query": fmt.Sprintf(`
+		{
+			stakeUpdates(first: %d, orderBy: id, orderDirection: asc, where: {validatorId: %d, nonce: %d, id_gt: %s}){
+				id
+				nonce
+				block
+				logIndex
+		   }
+		}
+		`, first, validatorId, nonce, idJSON),
+	}
+
+	byteQuery, _ := json.Marshal(query)
+	return byteQuery
+}
+
+func getMetaQuery() []byte {
+	query := map[string]string{
+		"query": `{ _meta { block { number } } }`,
+	}
+
+	byteQuery, _ := json.Marshal(query)
+	return byteQuery
+}
+
+func nonceAlias(validatorId int) string {
+	return "v" + strconv.Itoa(validatorId)
+}
+
+func signerChangeAlias(validatorId int) string {
+	return nonceAlias(validatorId) + "_signer"
+}
+
+func unstakeInitAlias(validatorId int) string {
+	return nonceAlias(validatorId) + "_unstake"
+}
+
+func getLatestNoncesQuery(validatorIds []int, orderBy string, orderDirection string) []byte {
+	var builder strings.Builder
+	builder.WriteString("{\n")
+	for _, validatorId := range validatorIds {
+		fmt.Fprintf(&builder, "\t%s\n", latestNonceSelection(validatorId, orderBy, orderDirection))
+	}
+	builder.WriteString("}")
+
+	byteQuery, _ := json.Marshal(map[string]string{"query": builder.String()})
+	return byteQuery
+}
@@ -0,0 +1,447 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestSubgraph returns an HTTPSubgraph querying a server that answers
+// every query with the response of respond. The queries sent are appended to
+// queries when it isn't nil.
+func newTestSubgraph(t *testing.T, queries *[]string, respond func(query string) string) *HTTPSubgraph {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if queries != nil {
+			*queries = append(*queries, string(body))
+		}
+		fmt.Fprint(w, respond(string(body)))
+	}))
+	t.Cleanup(server.Close)
+	return &HTTPSubgraph{URLs: []string{server.URL}, Client: server.Client()}
+}
+
+func TestLatestNonceTakesNewestEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     int
+	}{
+		{
+			name:     "stake-update newest",
+			response: `{"data":{"v7":[{"nonce":"9","block":"10","logIndex":"0"}],"v7_signer":[{"nonce":"4"}],"v7_unstake":[]}}`,
+			want:     9,
+		},
+		{
+			name:     "signer change newest",
+			response: `{"data":{"v7":[{"nonce":"4","block":"10","logIndex":"0"}],"v7_signer":[{"nonce":"5"}],"v7_unstake":[]}}`,
+			want:     5,
+		},
+		{
+			name:     "unstake newest",
+			response: `{"data":{"v7":[{"nonce":"4","block":"10","logIndex":"0"}],"v7_signer":[{"nonce":"5"}],"v7_unstake":[{"nonce":"6"}]}}`,
+			want:     6,
+		},
+		{
+			name:     "only an unstake",
+			response: `{"data":{"v7":[],"v7_signer":[],"v7_unstake":[{"nonce":"1"}]}}`,
+			want:     1,
+		},
+		{
+			name:     "no events",
+			response: `{"data":{"v7":[],"v7_signer":[],"v7_unstake":[]}}`,
+			want:     0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subgraph := newTestSubgraph(t, nil, func(string) string { return test.response })
+			nonce, err := subgraph.LatestNonce(context.Background(), 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nonce != test.want {
+				t.Errorf("LatestNonce = %d, want %d", nonce, test.want)
+			}
+		})
+	}
+}
+
+func TestLatestNoncesTakesNewestEvent(t *testing.T) {
+	var queries []string
+	subgraph := newTestSubgraph(t, &queries, func(string) string {
+		return `{"data":{
+			"v7":[{"nonce":"4","block":"10","logIndex":"0"}],"v7_signer":[],"v7_unstake":[{"nonce":"5"}],
+			"v8":[{"nonce":"2","block":"10","logIndex":"0"}],"v8_signer":[],"v8_unstake":[],
+			"v9":[],"v9_signer":[],"v9_unstake":[]}}`
+	})
+	nonces, err := subgraph.LatestNonces(context.Background(), []int{7, 8, 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("sent %d queries, want a single one", len(queries))
+	}
+	for _, alias := range []string{"v7: stakeUpdates", "v7_signer: signerChanges", "v7_unstake: unstakeInits", "v9_unstake: unstakeInits"} {
+		if !strings.Contains(queries[0], alias) {
+			t.Errorf("query %s lacks %q", queries[0], alias)
+		}
+	}
+	want := map[int]int{7: 5, 8: 2}
+	if len(nonces) != len(want) || nonces[7] != want[7] || nonces[8] != want[8] {
+		t.Errorf("LatestNonces = %v, want %v", nonces, want)
+	}
+}
+
+func TestSignerChangeValidatePubKeyLength(t *testing.T) {
+	change := SignerChange{
+		ValidatorID:     "7",
+		Block:           "10",
+		Nonce:           "3",
+		LogIndex:        "0",
+		TransactionHash: "0x" + strings.Repeat("ab", 32),
+	}
+	for length, valid := range map[int]bool{127: false, 128: true, 129: false, 130: true, 131: false} {
+		change.SignerPubKey = "0x" + strings.Repeat("a", length)
+		if err := change.Validate(); (err == nil) != valid {
+			t.Errorf("Validate of a %d hex character public key = %v, want valid %v", length, err, valid)
+		}
+	}
+}
+
+func TestStakeUpdateEmptyData(t *testing.T) {
+	for _, response := range []string{`{"data":{}}`, `{"data":null}`, `{}`} {
+		subgraph := newTestSubgraph(t, nil, func(string) string { return response })
+		_, err := subgraph.StakeUpdate(context.Background(), 7, 4)
+		if err != ErrStakeUpdateNotIndexed {
+			t.Errorf("StakeUpdate of %s = %v, want ErrStakeUpdateNotIndexed", response, err)
+		}
+	}
+}
+
+func TestParseNonceBeyondIntRange(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "42", want: 42},
+		{value: "9223372036854775807", want: 9223372036854775807},
+		{value: "9223372036854775808", wantErr: true},
+		{value: "18446744073709551616", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseNonce(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseNonce(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseNonce(%q) = %d, want %d", test.value, got, test.want)
+		}
+	}
+}
+
+func TestLatestNonceBeyondIntRange(t *testing.T) {
+	subgraph := newTestSubgraph(t, nil, func(string) string {
+		return `{"data":{"v7":[{"nonce":"9223372036854775808","block":"10","logIndex":"0"}],"v7_signer":[],"v7_unstake":[]}}`
+	})
+	if nonce, err := subgraph.LatestNonce(context.Background(), 7); err == nil {
+		t.Errorf("LatestNonce = %d, want an error", nonce)
+	}
+}
+
+func TestStakedAmountBeyondInt64Range(t *testing.T) {
+	const wei = "123456789012345678901234567890"
+	amount, err := StakeUpdate{TotalStaked: wei}.StakedAmount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amount.String() != wei {
+		t.Errorf("StakedAmount = %s, want %s", amount, wei)
+	}
+}
+
+func TestStakeUpdateValidateMalformedFields(t *testing.T) {
+	valid := StakeUpdate{
+		ValidatorID:     "7",
+		TotalStaked:     "1000000000000000000000",
+		Block:           "10",
+		Nonce:           "3",
+		TransactionHash: "0x" + strings.Repeat("ab", 32),
+		LogIndex:        "0",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate of a well-formed stake-update = %v", err)
+	}
+
+	tests := []struct {
+		field  string
+		modify func(u *StakeUpdate)
+	}{
+		{"validatorId", func(u *StakeUpdate) { u.ValidatorID = "" }},
+		{"validatorId", func(u *StakeUpdate) { u.ValidatorID = "-7" }},
+		{"block", func(u *StakeUpdate) { u.Block = "0" }},
+		{"block", func(u *StakeUpdate) { u.Block = "0x10" }},
+		{"nonce", func(u *StakeUpdate) { u.Nonce = "three" }},
+		{"nonce", func(u *StakeUpdate) { u.Nonce = "-1" }},
+		{"logIndex", func(u *StakeUpdate) { u.LogIndex = "" }},
+		{"totalStaked", func(u *StakeUpdate) { u.TotalStaked = "1e21" }},
+		{"totalStaked", func(u *StakeUpdate) { u.TotalStaked = "-1" }},
+		{"transactionHash", func(u *StakeUpdate) { u.TransactionHash = strings.Repeat("ab", 32) }},
+		{"transactionHash", func(u *StakeUpdate) { u.TransactionHash = "0x" + strings.Repeat("ab", 31) }},
+	}
+	for _, test := range tests {
+		stakeUpdate := valid
+		test.modify(&stakeUpdate)
+		err := stakeUpdate.Validate()
+		if err == nil || !strings.Contains(err.Error(), "field "+test.field+" ") {
+			t.Errorf("Validate of %+v = %v, want an error naming %s", stakeUpdate, err, test.field)
+		}
+	}
+}
+
+func TestPaginateTermination(t *testing.T) {
+	page := func(ids ...string) string {
+		entries := make([]string, len(ids))
+		for i, id := range ids {
+			entries[i] = fmt.Sprintf(`{"id":%q}`, id)
+		}
+		return `{"data":{"stakeUpdates":[` + strings.Join(entries, ",") + `]}}`
+	}
+	tests := []struct {
+		name         string
+		maxPages     int
+		pages        []string
+		wantIds      []string
+		wantAfterIds []string
+		wantErr      string
+	}{
+		{
+			name:         "short last page",
+			pages:        []string{page("a", "b"), page("c")},
+			wantIds:      []string{"a", "b", "c"},
+			wantAfterIds: []string{"", "b"},
+		},
+		{
+			name:         "empty last page",
+			pages:        []string{page("a", "b"), page()},
+			wantIds:      []string{"a", "b"},
+			wantAfterIds: []string{"", "b"},
+		},
+		{
+			name:         "single short page",
+			pages:        []string{page("a")},
+			wantIds:      []string{"a"},
+			wantAfterIds: []string{""},
+		},
+		{
+			name:         "cursor not advancing",
+			pages:        []string{page("a", "b"), page("a", "b")},
+			wantAfterIds: []string{"", "b"},
+			wantErr:      "cursor didn't advance",
+		},
+		{
+			name:         "more than max pages",
+			maxPages:     2,
+			pages:        []string{page("a", "b"), page("c", "d"), page("e")},
+			wantAfterIds: []string{"", "b"},
+			wantErr:      "more than 2 pages",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			served := 0
+			subgraph := newTestSubgraph(t, nil, func(string) string {
+				served++
+				return test.pages[served-1]
+			})
+			subgraph.PageSize = 2
+			subgraph.MaxPages = test.maxPages
+
+			var afterIds []string
+			stakeUpdates, err := subgraph.paginate(context.Background(), func(first int, afterId string) []byte {
+				if first != 2 {
+					t.Errorf("page of %d, want 2", first)
+				}
+				afterIds = append(afterIds, afterId)
+				return []byte(`{"query":"{ stakeUpdates { id } }"}`)
+			})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("paginate = %v, want an error containing %q", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, stakeUpdate := range stakeUpdates {
+				ids = append(ids, stakeUpdate.ID)
+			}
+			if !reflect.DeepEqual(ids, test.wantIds) {
+				t.Errorf("paginate returned %v, want %v", ids, test.wantIds)
+			}
+			if !reflect.DeepEqual(afterIds, test.wantAfterIds) {
+				t.Errorf("queried after %q, want %q", afterIds, test.wantAfterIds)
+			}
+		})
+	}
+}
+
+func TestLatestStakeUpdateOrdering(t *testing.T) {
+	tests := []struct {
+		name         string
+		stakeUpdates []StakeUpdate
+		wantId       string
+	}{
+		{
+			name: "highest nonce",
+			stakeUpdates: []StakeUpdate{
+				{ID: "a", Nonce: "9", Block: "100", LogIndex: "5"},
+				{ID: "b", Nonce: "10", Block: "90", LogIndex: "0"},
+			},
+			wantId: "b",
+		},
+		{
+			name: "same nonce, latest block",
+			stakeUpdates: []StakeUpdate{
+				{ID: "a", Nonce: "10", Block: "99", LogIndex: "7"},
+				{ID: "b", Nonce: "10", Block: "100", LogIndex: "1"},
+			},
+			wantId: "b",
+		},
+		{
+			name: "same nonce and block, latest log index",
+			stakeUpdates: []StakeUpdate{
+				{ID: "a", Nonce: "10", Block: "100", LogIndex: "10"},
+				{ID: "b", Nonce: "10", Block: "100", LogIndex: "9"},
+			},
+			wantId: "a",
+		},
+		{
+			name: "three sharing the nonce, the last latest",
+			stakeUpdates: []StakeUpdate{
+				{ID: "a", Nonce: "10", Block: "100", LogIndex: "3"},
+				{ID: "b", Nonce: "10", Block: "99", LogIndex: "9"},
+				{ID: "c", Nonce: "10", Block: "101", LogIndex: "0"},
+			},
+			wantId: "c",
+		},
+		{
+			name: "compared numerically",
+			stakeUpdates: []StakeUpdate{
+				{ID: "a", Nonce: "9", Block: "100", LogIndex: "0"},
+				{ID: "b", Nonce: "10", Block: "100", LogIndex: "0"},
+				{ID: "c", Nonce: "10", Block: "1000", LogIndex: "0"},
+			},
+			wantId: "c",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			latest, ok := latestStakeUpdate(7, test.stakeUpdates)
+			if !ok || latest.ID != test.wantId {
+				t.Errorf("latestStakeUpdate = %q, want %q", latest.ID, test.wantId)
+			}
+			reversed := make([]StakeUpdate, len(test.stakeUpdates))
+			for i, stakeUpdate := range test.stakeUpdates {
+				reversed[len(reversed)-1-i] = stakeUpdate
+			}
+			if latest, _ = latestStakeUpdate(7, reversed); latest.ID != test.wantId {
+				t.Errorf("latestStakeUpdate of the reversed order = %q, want %q", latest.ID, test.wantId)
+			}
+		})
+	}
+	if _, ok := latestStakeUpdate(7, nil); ok {
+		t.Error("latestStakeUpdate of no stake-updates found one")
+	}
+}
+
+func TestLatestNonceQueryOrdering(t *testing.T) {
+	const noEvents = `{"data":{"v7":[],"v7_signer":[],"v7_unstake":[]}}`
+	tests := []struct {
+		name           string
+		orderBy        string
+		orderDirection string
+		want           string
+	}{
+		{name: "default", want: "orderBy: nonce, orderDirection: desc"},
+		{name: "by block", orderBy: "block", orderDirection: "desc", want: "orderBy: block, orderDirection: desc"},
+		{name: "ascending", orderBy: "nonce", orderDirection: "asc", want: "orderBy: nonce, orderDirection: asc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var queries []string
+			subgraph := newTestSubgraph(t, &queries, func(string) string { return noEvents })
+			subgraph.LatestOrderBy, subgraph.LatestOrderDirection = test.orderBy, test.orderDirection
+			if _, err := subgraph.LatestNonce(context.Background(), 7); err != nil {
+				t.Fatal(err)
+			}
+			wants := []string{
+				fmt.Sprintf("v7: stakeUpdates(first: %d, %s, where: {validatorId: 7}){ nonce block logIndex }", latestNonceCandidates, test.want),
+				fmt.Sprintf("v7_signer: signerChanges(first: 1, %s, where: {validatorId: 7}){ nonce }", test.want),
+				fmt.Sprintf("v7_unstake: unstakeInits(first: 1, %s, where: {validatorId: 7}){ nonce }", test.want),
+			}
+			for _, want := range wants {
+				if !strings.Contains(queries[0], want) {
+					t.Errorf("query %s lacks %q", queries[0], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLatestNonceFetchesEveryTiedStakeUpdate(t *testing.T) {
+	var queries []string
+	subgraph := newTestSubgraph(t, &queries, func(query string) string {
+		if strings.Contains(query, "nonce: 10, id_gt:") {
+			return `{"data":{"stakeUpdates":[
+				{"id":"a","nonce":"10","block":"100","logIndex":"3"},
+				{"id":"b","nonce":"10","block":"99","logIndex":"9"},
+				{"id":"c","nonce":"10","block":"101","logIndex":"0"}]}}`
+		}
+		return `{"data":{"v7":[{"nonce":"10","block":"100","logIndex":"3"},{"nonce":"10","block":"99","logIndex":"9"}],"v7_signer":[{"nonce":"9"}],"v7_unstake":[]}}`
+	})
+	nonce, err := subgraph.LatestNonce(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 10 {
+		t.Errorf("LatestNonce = %d, want 10", nonce)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("sent %d queries, want the latest-nonce query then the tied stake-updates", len(queries))
+	}
+	if want := "stakeUpdates(first: 1000, orderBy: id, orderDirection: asc, where: {validatorId: 7, nonce: 10, id_gt:"; !strings.Contains(queries[1], want) {
+		t.Errorf("query %s lacks %q", queries[1], want)
+	}
+}
+
+func TestLatestNonceSkipsTieQueryWithoutTie(t *testing.T) {
+	var queries []string
+	subgraph := newTestSubgraph(t, &queries, func(string) string {
+		return `{"data":{"v7":[{"nonce":"10","block":"100","logIndex":"3"},{"nonce":"9","block":"99","logIndex":"0"}],"v7_signer":[],"v7_unstake":[]}}`
+	})
+	if _, err := subgraph.LatestNonce(context.Background(), 7); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 {
+		t.Errorf("sent %d queries, want a single one", len(queries))
+	}
+}
+
+func TestStakeUpdateEmptyArray(t *testing.T) {
+	subgraph := newTestSubgraph(t, nil, func(string) string { return `{"data":{"stakeUpdates":[]}}` })
+	if _, err := subgraph.StakeUpdate(context.Background(), 7, 4); err != ErrStakeUpdateNotIndexed {
+		t.Errorf("StakeUpdate = %v, want ErrStakeUpdateNotIndexed", err)
+	}
+}
@@ -0,0 +1,215 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Submitter sends a stake-update, signer-update or validator-exit to
+// Heimdall.
+type Submitter interface {
+	SubmitStakeUpdate(ctx context.Context, update StakeUpdate) error
+	SubmitSignerUpdate(ctx context.Context, change SignerChange) error
+	SubmitValidatorExit(ctx context.Context, exit ValidatorExit) error
+}
+
+// RESTSubmitter submits stake-updates without heimdallcli, through the
+// Heimdall REST API: POST /staking/stake-update generates the unsigned tx,
+// which is signed with Key the way heimdallcli signs it and broadcast with
+// POST /txs.
+type RESTSubmitter struct {
+	URL     string
+	ChainID string
+	Key     *ecdsa.PrivateKey
+	Client  *http.Client
+}
+
+// From returns the Heimdall address of Key.
+func (s *RESTSubmitter) From() common.Address {
+	return crypto.PubkeyToAddress(s.Key.PublicKey)
+}
+
+func (s *RESTSubmitter) SubmitStakeUpdate(ctx context.Context, update StakeUpdate) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+	return s.submit(ctx, "/staking/stake-update", map[string]interface{}{
+		"id":           update.ValidatorID,
+		"amount":       update.TotalStaked,
+		"tx_hash":      update.TransactionHash,
+		"log_index":    update.LogIndex,
+		"block_number": update.Block,
+		"nonce":        update.Nonce,
+	})
+}
+
+func (s *RESTSubmitter) SubmitSignerUpdate(ctx context.Context, change SignerChange) error {
+	if err := change.Validate(); err != nil {
+		return err
+	}
+	return s.submit(ctx, "/staking/signer-update", map[string]interface{}{
+		"id":           change.ValidatorID,
+		"new_pubkey":   change.SignerPubKey,
+		"tx_hash":      change.TransactionHash,
+		"log_index":    change.LogIndex,
+		"block_number": change.Block,
+		"nonce":        change.Nonce,
+	})
+}
+
+func (s *RESTSubmitter) SubmitValidatorExit(ctx context.Context, exit ValidatorExit) error {
+	if err := exit.Validate(); err != nil {
+		return err
+	}
+	return s.submit(ctx, "/staking/validator-exit", map[string]interface{}{
+		"id":                 exit.ValidatorID,
+		"deactivation_epoch": exit.DeactivationEpoch,
+		"tx_hash":            exit.TransactionHash,
+		"log_index":          exit.LogIndex,
+		"block_number":       exit.Block,
+		"nonce":              exit.Nonce,
+	})
+}
+
+// submit has Heimdall generate the tx for request at path, then signs and
+// broadcasts it.
+func (s *RESTSubmitter) submit(ctx context.Context, path string, request map[string]interface{}) error {
+	account, err := s.account(ctx)
+	if err != nil {
+		return err
+	}
+
+	var generated struct {
+		Value struct {
+			Msg  json.RawMessage `json:"msg"`
+			Memo string          `json:"memo"`
+		} `json:"value"`
+	}
+	request["base_req"] = map[string]string{
+		"from":     s.From().Hex(),
+		"chain_id": s.ChainID,
+	}
+	kind := strings.TrimPrefix(path, "/staking/")
+	if err = s.post(ctx, path, request, &generated); err != nil {
+		return fmt.Errorf("generating %s tx: %v", kind, err)
+	}
+
+	signature, err := s.sign(generated.Value.Msg, generated.Value.Memo, account)
+	if err != nil {
+		return err
+	}
+
+	var broadcast struct {
+		TxHash string `json:"txhash"`
+		Code   int    `json:"code"`
+		RawLog string `json:"raw_log"`
+	}
+	tx := map[string]interface{}{
+		"tx": map[string]interface{}{
+			"msg":       generated.Value.Msg,
+			"signature": base64.StdEncoding.EncodeToString(signature),
+			"memo":      generated.Value.Memo,
+		},
+		"mode": "sync",
+	}
+	if err = s.post(ctx, "/txs", tx, &broadcast); err != nil {
+		return fmt.Errorf("broadcasting %s tx: %v", kind, err)
+	}
+	if broadcast.Code != 0 {
+		return fmt.Errorf("%s tx %s rejected with code %d: %s", kind, broadcast.TxHash, broadcast.Code, broadcast.RawLog)
+	}
+	return nil
+}
+
+type heimdallAccount struct {
+	AccountNumber flexInt `json:"account_number"`
+	Sequence      flexInt `json:"sequence"`
+}
+
+func (s *RESTSubmitter) account(ctx context.Context) (heimdallAccount, error) {
+	var response struct {
+		Result struct {
+			heimdallAccount
+			Value *heimdallAccount `json:"value"`
+		} `json:"result"`
+	}
+	requestUrl := s.URL + "/auth/accounts/" + s.From().Hex()
+	request, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
+	if err != nil {
+		return heimdallAccount{}, err
+	}
+	if err = s.do(request, &response); err != nil {
+		return heimdallAccount{}, fmt.Errorf("getting account %s: %v", s.From().Hex(), err)
+	}
+	if response.Result.Value != nil {
+		return *response.Result.Value, nil
+	}
+	return response.Result.heimdallAccount, nil
+}
+
+// sign returns the signature over the sorted-key sign document, a 65 byte
+// secp256k1 signature of its keccak256 hash as Heimdall expects.
+func (s *RESTSubmitter) sign(msg json.RawMessage, memo string, account heimdallAccount) ([]byte, error) {
+	var compactMsg bytes.Buffer
+	if err := json.Compact(&compactMsg, msg); err != nil {
+		return nil, fmt.Errorf("invalid generated msg: %v", err)
+	}
+	// encoding/json sorts map keys, giving the canonical sign bytes.
+	signDoc, err := json.Marshal(map[string]interface{}{
+		"account_number": fmt.Sprint(int64(account.AccountNumber)),
+		"chain_id":       s.ChainID,
+		"memo":           memo,
+		"msg":            json.RawMessage(compactMsg.Bytes()),
+		"sequence":       fmt.Sprint(int64(account.Sequence)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Sign(crypto.Keccak256(signDoc), s.Key)
+}
+
+func (s *RESTSubmitter) post(ctx context.Context, path string, body interface{}, response interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", s.URL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return s.do(request, response)
+}
+
+func (s *RESTSubmitter) do(request *http.Request, response interface{}) error {
+	httpResponse, err := s.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	data, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		return fmt.Errorf("heimdall returned %s: %s", httpResponse.Status, bodySnippet(data))
+	}
+	return json.Unmarshal(data, response)
+}
+
+// ParsePrivateKey parses a hex encoded secp256k1 private key, with or
+// without the 0x prefix.
+func ParsePrivateKey(value string) (*ecdsa.PrivateKey, error) {
+	return crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(value), "0x"))
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stake-update-go/clients"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/joho/godotenv"
+)
+
+var (
+	HeimdallRestUrl     string
+	PolygonSubGraphUrls []string
+	HeimdallChainId     string
+	EthereumRPCUrl      string
+	StateFile           string
+	PollInterval        time.Duration
+	MetricsAddr         string
+	StatsdAddr          string
+	DebugAuthToken      string
+	ReconcileInterval   time.Duration
+	// BlockConflictAction decides what happens when the RPC block at the
+	// subgraph-provided height doesn't contain the stake-update tx:
+	// "retry" skips and retries next cycle, "requery" re-reads the subgraph once.
+	BlockConflictAction string
+	// StrictMode makes the tool exit on conditions it would otherwise only
+	// warn about, such as a validator id that doesn't seem to exist.
+	StrictMode bool
+	// PauseFile, when set, pauses submissions while the file exists.
+	PauseFile string
+	// ForceSubmit submits stake-updates regardless of min_block_age, set by
+	// `submit -force`.
+	ForceSubmit bool
+	// AuditFile, when set, receives a JSON line for every submission.
+	AuditFile string
+	// AuditFileMaxBytes is the size past which AuditFile is rotated, zero
+	// never rotates it.
+	AuditFileMaxBytes int64
+	// DryRun logs the heimdallcli command instead of running it.
+	DryRun bool
+	// DrainTimeout bounds how long a drain waits for in-flight submissions.
+	DrainTimeout time.Duration
+	// ConfirmationBlockTag is the block reference a stake-update block must be
+	// at or below before it's submitted: latest, safe or finalized.
+	ConfirmationBlockTag string
+	// StatusInterval is how often the one-line status summary is printed,
+	// zero disables it.
+	StatusInterval time.Duration
+	// KeepInactiveValidators keeps watching validators that have unstaked
+	// instead of retiring them.
+	KeepInactiveValidators bool
+	// BackoffResetSuccesses is how many consecutive successful cycles are
+	// needed before the retry backoff drops back to its base delay.
+	BackoffResetSuccesses int
+	// BackoffBase and BackoffMax bound the retry delay after failed cycles.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// EthereumNonceRefresh is how often the Ethereum nonce is re-read from the
+	// subgraph, zero refreshes it every cycle.
+	EthereumNonceRefresh time.Duration
+	// MinSubmitInterval is the minimum time between two successful
+	// submissions for the same validator.
+	MinSubmitInterval time.Duration
+	// SubmitCooldown is how long a validator isn't polled after a
+	// submission, so Heimdall and the subgraph reflect it first.
+	SubmitCooldown time.Duration
+	// HealthAddr is where /healthz and /readyz are served, empty disables
+	// them.
+	HealthAddr string
+	// HealthMaxFailures is how many consecutive failed cycles of every
+	// validator make /healthz report unhealthy.
+	HealthMaxFailures int
+	// HeimdallValidatorPath is the Heimdall validator endpoint, with {id}
+	// replaced by the validator id.
+	HeimdallValidatorPath string
+	// HeimdallValidatorSetPath is the Heimdall validator set endpoint, read
+	// by -all.
+	HeimdallValidatorSetPath string
+	// DiscoveryInterval is how often -all re-reads the validator set.
+	DiscoveryInterval time.Duration
+	// MaxConcurrentValidators bounds how many validators run a cycle at the
+	// same time, zero doesn't bound it.
+	MaxConcurrentValidators int
+	// BlockCacheSize is how many finalized blocks are kept in memory, zero
+	// disables the cache.
+	BlockCacheSize int
+	// SubgraphMaxLag is how many blocks the subgraph may be behind the
+	// Ethereum head before a warning is logged.
+	SubgraphMaxLag int
+	// SubgraphApiKey is sent as a bearer token to authenticated subgraph
+	// endpoints such as Subgraph Studio.
+	SubgraphApiKey string
+	// SubgraphTimeout bounds every subgraph query.
+	SubgraphTimeout time.Duration
+	// SubgraphHeaders are extra headers sent with every subgraph query.
+	SubgraphHeaders map[string]string
+	// SubgraphRps and SubgraphBurst rate limit the subgraph queries of all
+	// validators together. A rate of zero disables the limit.
+	SubgraphRps   float64
+	SubgraphBurst int
+	// SubgraphMaxResults is how many matches a stake-update query asks for.
+	SubgraphMaxResults int
+	// SubgraphPageSize and SubgraphMaxPages bound paginated subgraph
+	// queries.
+	SubgraphPageSize int
+	SubgraphMaxPages int
+	// SubgraphLatestOrderBy and SubgraphLatestOrderDirection order the
+	// events of latest-nonce queries.
+	SubgraphLatestOrderBy        string
+	SubgraphLatestOrderDirection string
+	// HeimdallcliCommandTemplate is the heimdallcli argv of a stake-update,
+	// with {placeholders} filled in from the stake-update.
+	HeimdallcliCommandTemplate []string
+	// HeimdallcliExtraArgs are appended to every heimdallcli invocation, e.g.
+	// fees, keyring options or --yes.
+	HeimdallcliExtraArgs []string
+	// HeimdallcliNode and HeimdallcliHome, when set, are passed to heimdallcli
+	// as --node and --home for the validators of the default profile.
+	HeimdallcliNode string
+	HeimdallcliHome string
+	// HeimdallcliTimeout bounds a single heimdallcli run.
+	HeimdallcliTimeout time.Duration
+	// HeimdallcliRetries is how many times heimdallcli is re-run after a
+	// transient failure such as an account sequence mismatch.
+	HeimdallcliRetries int
+	// HeimdallcliRetryDelay is the wait between those re-runs.
+	HeimdallcliRetryDelay time.Duration
+	// HeimdallcliBreakerFailures is how many consecutive failed submissions
+	// open the circuit breaker, zero disables it.
+	HeimdallcliBreakerFailures int
+	// HeimdallcliBreakerCooldown is how long the open breaker holds back
+	// submissions before trying one.
+	HeimdallcliBreakerCooldown time.Duration
+	// MaxUpdatesPerCycle caps how many stake-updates are submitted for a
+	// validator in one cycle, bounding the burst when the gap is large.
+	MaxUpdatesPerCycle int
+	// AlertWebhookUrl receives a JSON POST when a validator's stake-update
+	// keeps failing, and when it recovers.
+	AlertWebhookUrl string
+	// AlertAfterFailures is how many consecutive failures trigger the alert.
+	AlertAfterFailures int
+	// ResubmitAfter is how long a nonce recorded in the state file as
+	// submitted is left alone, giving Heimdall time to reflect it, before it
+	// may be submitted again.
+	ResubmitAfter time.Duration
+	// MinBlockAge is how old the stake-update block must be before it's
+	// submitted.
+	MinBlockAge time.Duration
+	// SubmitMode is how stake-updates reach Heimdall: exec runs heimdallcli,
+	// rpc signs and broadcasts the tx through the Heimdall REST API.
+	SubmitMode string
+	// HeimdallPrivateKey signs the txs in rpc submit_mode.
+	HeimdallPrivateKey *ecdsa.PrivateKey
+	// FreshnessSource is what MinBlockAge is measured against: wallclock, the
+	// local clock, or chainhead, the latest block's timestamp.
+	FreshnessSource string
+	// ConfirmTimeout is how long to wait for Heimdall to reflect a submitted
+	// nonce before moving on to the next one. Zero disables the wait.
+	ConfirmTimeout time.Duration
+	// StartupJitter delays the first poll of each validator by a random part
+	// of the poll interval when several are watched.
+	StartupJitter bool
+	// PollJitterPercent varies every poll interval by up to this percentage
+	// either way.
+	PollJitterPercent int
+	// MinPower skips submitting for validators whose Heimdall voting power
+	// is below it. Zero disables the filter.
+	MinPower int
+	// ProxyUrl, when set, is used for all outbound HTTP instead of the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyUrl string
+	// HTTPTransport is shared by every outbound HTTP client.
+	HTTPTransport *http.Transport
+	// HeimdallTransport is used for the Heimdall REST API. It presents the
+	// heimdall_tls_cert client certificate when one is configured and is
+	// HTTPTransport otherwise.
+	HeimdallTransport *http.Transport
+	// LogPayloadMaxBytes cuts the request and response bodies logged at
+	// debug level.
+	LogPayloadMaxBytes int
+	// VerifyStakeEvent checks every stake-update against the StakeUpdate
+	// event in its transaction receipt before submitting it.
+	VerifyStakeEvent bool
+	// StakingInfoAddress, when set, is the contract the event must come from.
+	StakingInfoAddress common.Address
+	// EthDialWindow is how long dialing the Ethereum RPC is retried at
+	// startup before giving up.
+	EthDialWindow time.Duration
+)
+
+// Features holds the experimental behaviours enabled through the `features`
+// env var, e.g. `features=batch_nonce_queries,rpc_submit`. Everything is off
+// unless listed, and every decision point checks featureEnabled.
+var Features = map[string]bool{}
+
+// The experimental features.
+const (
+	// featureBatchNonceQueries fetches the Ethereum nonce of all validators
+	// in one subgraph request per cycle.
+	featureBatchNonceQueries = "batch_nonce_queries"
+	// featureRPCSubmit allows submit_mode rpc, which submits without
+	// heimdallcli.
+	featureRPCSubmit = "rpc_submit"
+)
+
+var knownFeatures = []string{featureBatchNonceQueries, featureRPCSubmit}
+
+// loadConfig loads envFile into the environment and reads the configuration
+// from it. Variables already set in the environment take precedence over the
+// file. A missing file is fine unless it was asked for explicitly, as long as
+// the required variables come from the environment.
+func loadConfig(envFile string, explicit bool) {
+	err := godotenv.Load(envFile)
+	if err != nil && (explicit || !os.IsNotExist(err)) {
+		log.Fatalf("Error loading env file %s: %v", envFile, err)
+	}
+
+	err = setupLogging(getEnvDefault("LOG_LEVEL", "info"), getEnvDefault("LOG_FORMAT", "text"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	Network = os.Getenv("network")
+	if Network != "" {
+		if err = applyNetwork(Network); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err = validateRequiredEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	EthereumRPCUrl = os.Getenv("ethereum_rpc_url")
+	PolygonSubGraphUrls = splitList(os.Getenv("polygon_sub_graph_url"))
+	HeimdallRestUrl = os.Getenv("heimdall_rest_url")
+	HeimdallChainId = os.Getenv("heimdall_chain_id")
+	StateFile = os.Getenv("state_file")
+	PollInterval, err = parsePollInterval(os.Getenv("poll_interval_seconds"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	StartupJitter = os.Getenv("startup_jitter") == "" || getEnvBool("startup_jitter")
+	PollJitterPercent = getEnvInt("poll_jitter_percent", 0)
+	if PollJitterPercent < 0 || PollJitterPercent > 50 {
+		log.Fatalf("Invalid poll_jitter_percent: %d, expected 0 to 50", PollJitterPercent)
+	}
+	LogPayloadMaxBytes = getEnvInt("log_payload_max_bytes", 2000)
+	ProxyUrl = os.Getenv("proxy_url")
+	HTTPTransport, err = clients.NewTransport(ProxyUrl)
+	if err != nil {
+		log.Fatalf("Invalid proxy_url: %v", err)
+	}
+	HeimdallTransport = HTTPTransport
+	certFile, keyFile, caFile := os.Getenv("heimdall_tls_cert"), os.Getenv("heimdall_tls_key"), os.Getenv("heimdall_tls_ca")
+	if (certFile == "") != (keyFile == "") {
+		log.Fatal("Invalid heimdall_tls_cert: heimdall_tls_cert and heimdall_tls_key must be set together")
+	}
+	if certFile == "" && caFile != "" {
+		log.Fatal("Invalid heimdall_tls_ca: requires heimdall_tls_cert and heimdall_tls_key")
+	}
+	if certFile != "" {
+		tlsConfig, err := clients.NewClientTLSConfig(certFile, keyFile, caFile)
+		if err != nil {
+			log.Fatalf("Invalid heimdall_tls_cert: %v", err)
+		}
+		HeimdallTransport = HTTPTransport.Clone()
+		HeimdallTransport.TLSClientConfig = tlsConfig
+	}
+	MetricsAddr = os.Getenv("metrics_addr")
+	StatsdAddr = os.Getenv("statsd_addr")
+	DebugAuthToken = os.Getenv("debug_auth_token")
+	ReconcileInterval = getEnvSeconds("reconcile_interval_seconds", 0)
+	BlockConflictAction = os.Getenv("block_conflict_action")
+	switch BlockConflictAction {
+	case "":
+		BlockConflictAction = "retry"
+	case "retry", "requery":
+	default:
+		log.Fatalf("Invalid block_conflict_action: %q, expected retry or requery", BlockConflictAction)
+	}
+	StrictMode = getEnvBool("strict_mode")
+	DryRun = getEnvBool("dry_run")
+	DrainTimeout = getEnvSeconds("drain_timeout_seconds", 60*time.Second)
+	KeepInactiveValidators = getEnvBool("keep_inactive_validators")
+	EthereumNonceRefresh = getEnvSeconds("ethereum_nonce_refresh_seconds", 0)
+	MinSubmitInterval = getEnvSeconds("min_submit_interval_seconds", 0)
+	PauseFile = os.Getenv("pause_file")
+	AuditFile = os.Getenv("audit_file")
+	auditFileMaxMb := getEnvInt("audit_file_max_mb", 100)
+	if auditFileMaxMb < 0 {
+		log.Fatalf("Invalid audit_file_max_mb: %d, expected a non-negative number", auditFileMaxMb)
+	}
+	AuditFileMaxBytes = int64(auditFileMaxMb) << 20
+	SubmitCooldown = getEnvSeconds("submit_cooldown_seconds", 30*time.Second)
+	HeimdallcliCommandTemplate = defaultCommandTemplate
+	if template := os.Getenv("heimdallcli_command_template"); template != "" {
+		if HeimdallcliCommandTemplate, err = parseArgs(template); err != nil {
+			log.Fatal(err)
+		}
+		if err = checkCommandTemplate(HeimdallcliCommandTemplate); err != nil {
+			log.Fatalf("Invalid heimdallcli_command_template: %v", err)
+		}
+	}
+	HeimdallcliExtraArgs, err = parseArgs(os.Getenv("heimdallcli_extra_args"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	HeimdallcliNode = os.Getenv("heimdallcli_node")
+	HeimdallcliHome = os.Getenv("heimdallcli_home")
+	HeimdallcliTimeout = getEnvSeconds("heimdallcli_timeout_seconds", time.Minute)
+	if HeimdallcliTimeout <= 0 {
+		log.Fatal("Invalid heimdallcli_timeout_seconds: expected a positive number of seconds")
+	}
+	HeimdallcliRetries = getEnvInt("heimdallcli_retries", 2)
+	if HeimdallcliRetries < 0 {
+		log.Fatalf("Invalid heimdallcli_retries: %d, expected a non-negative number", HeimdallcliRetries)
+	}
+	HeimdallcliRetryDelay = getEnvSeconds("heimdallcli_retry_delay_seconds", 2*time.Second)
+	HeimdallcliBreakerFailures = getEnvInt("heimdallcli_breaker_failures", 0)
+	if HeimdallcliBreakerFailures < 0 {
+		log.Fatalf("Invalid heimdallcli_breaker_failures: %d, expected a non-negative number", HeimdallcliBreakerFailures)
+	}
+	HeimdallcliBreakerCooldown = getEnvSeconds("heimdallcli_breaker_cooldown_seconds", 5*time.Minute)
+	if HeimdallcliBreakerCooldown <= 0 {
+		log.Fatal("Invalid heimdallcli_breaker_cooldown_seconds: expected a positive number of seconds")
+	}
+	Features, err = parseFeatures(os.Getenv("features"))
+	if err != nil {
+		log.Fatalf("Invalid features: %v", err)
+	}
+	// batch_nonce_queries=true predates features and still enables it.
+	if getEnvBool("batch_nonce_queries") {
+		Features[featureBatchNonceQueries] = true
+	}
+	SubmitMode = getEnvDefault("submit_mode", "exec")
+	switch SubmitMode {
+	case "exec":
+	case "rpc":
+		if !featureEnabled(featureRPCSubmit) {
+			log.Fatalf("Invalid submit_mode: rpc is experimental, add %s to features to use it", featureRPCSubmit)
+		}
+		HeimdallPrivateKey, err = clients.ParsePrivateKey(os.Getenv("heimdall_private_key"))
+		if err != nil {
+			log.Fatalf("Invalid heimdall_private_key: %v, required with submit_mode rpc", err)
+		}
+	default:
+		log.Fatalf("Invalid submit_mode: %q, expected exec or rpc", SubmitMode)
+	}
+	MaxUpdatesPerCycle = getEnvInt("max_updates_per_cycle", 5)
+	if MaxUpdatesPerCycle < 1 {
+		log.Fatalf("Invalid max_updates_per_cycle: %d, expected at least 1", MaxUpdatesPerCycle)
+	}
+	AlertWebhookUrl = os.Getenv("alert_webhook_url")
+	AlertAfterFailures = getEnvInt("alert_after_failures", 3)
+	if AlertAfterFailures < 1 {
+		log.Fatalf("Invalid alert_after_failures: %d, expected at least 1", AlertAfterFailures)
+	}
+	ResubmitAfter = getEnvSeconds("resubmit_after_seconds", 5*time.Minute)
+	ConfirmTimeout = getEnvSeconds("confirm_timeout_seconds", 0)
+	MinBlockAge = getEnvSeconds("min_block_age_seconds", 10*time.Minute)
+	FreshnessSource = getEnvDefault("freshness_source", "wallclock")
+	if FreshnessSource != "wallclock" && FreshnessSource != "chainhead" {
+		log.Fatalf("Invalid freshness_source: %q, expected wallclock or chainhead", FreshnessSource)
+	}
+	BackoffBase = getEnvSeconds("backoff_base_seconds", time.Second)
+	BackoffMax = getEnvSeconds("backoff_max_seconds", time.Minute)
+	if BackoffBase <= 0 || BackoffMax < BackoffBase {
+		log.Fatalf("Invalid backoff: backoff_base_seconds (%s) must be positive and at most backoff_max_seconds (%s)", BackoffBase, BackoffMax)
+	}
+	EthDialWindow = getEnvSeconds("eth_dial_window_seconds", time.Minute)
+	BackoffResetSuccesses = getEnvInt("backoff_reset_successes", 1)
+	if BackoffResetSuccesses < 1 {
+		log.Fatalf("Invalid backoff_reset_successes: %d, expected at least 1", BackoffResetSuccesses)
+	}
+	StatusInterval = getEnvSeconds("status_interval_seconds", 0)
+	ConfirmationBlockTag = os.Getenv("confirmation_block_tag")
+	switch ConfirmationBlockTag {
+	case "":
+		ConfirmationBlockTag = "latest"
+	case "latest", "safe", "finalized":
+	default:
+		log.Fatalf("Invalid confirmation_block_tag: %q, expected latest, safe or finalized", ConfirmationBlockTag)
+	}
+
+	rules, err := parseErrorRules(os.Getenv("error_rules"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ErrorRules = append(rules, defaultErrorRules...)
+
+	SubmissionGroups, err = parseSubmissionGroups(os.Getenv("submission_groups"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	VerifyStakeEvent = getEnvBool("verify_stake_event")
+	if address := os.Getenv("staking_info_address"); address != "" {
+		if !common.IsHexAddress(address) {
+			log.Fatalf("Invalid staking_info_address: %q, expected a hex address", address)
+		}
+		StakingInfoAddress = common.HexToAddress(address)
+	}
+	MinPower = getEnvInt("min_power", 0)
+	if MinPower < 0 {
+		log.Fatalf("Invalid min_power: %d, expected a non-negative number", MinPower)
+	}
+
+	HealthAddr = os.Getenv("health_addr")
+	HealthMaxFailures = getEnvInt("health_max_failures", 5)
+	if HealthMaxFailures < 1 {
+		log.Fatalf("Invalid health_max_failures: %d, expected at least 1", HealthMaxFailures)
+	}
+	HeimdallValidatorPath = getEnvDefault("heimdall_validator_path", clients.DefaultValidatorPath)
+	if !strings.Contains(HeimdallValidatorPath, "{id}") {
+		log.Fatalf("Invalid heimdall_validator_path: %q, expected an {id} placeholder", HeimdallValidatorPath)
+	}
+	HeimdallValidatorSetPath = getEnvDefault("heimdall_validator_set_path", clients.DefaultValidatorSetPath)
+	DiscoveryInterval = getEnvSeconds("discovery_interval_seconds", 30*time.Minute)
+	if DiscoveryInterval <= 0 {
+		log.Fatal("Invalid discovery_interval_seconds: expected a positive number of seconds")
+	}
+	MaxConcurrentValidators = getEnvInt("max_concurrent_validators", 0)
+	if MaxConcurrentValidators < 0 {
+		log.Fatalf("Invalid max_concurrent_validators: %d, expected a non-negative number", MaxConcurrentValidators)
+	}
+	BlockCacheSize = getEnvInt("block_cache_size", 32)
+	if BlockCacheSize < 0 {
+		log.Fatalf("Invalid block_cache_size: %d, expected a non-negative number", BlockCacheSize)
+	}
+	SubgraphMaxLag = getEnvInt("subgraph_max_lag_blocks", 50)
+	SubgraphTimeout = getEnvSeconds("subgraph_timeout_seconds", 10*time.Second)
+	if SubgraphTimeout <= 0 {
+		log.Fatal("Invalid subgraph_timeout_seconds: expected a positive number of seconds")
+	}
+	SubgraphMaxResults = getEnvInt("subgraph_max_results", clients.DefaultMaxResults)
+	if SubgraphMaxResults < 1 {
+		log.Fatalf("Invalid subgraph_max_results: %d, expected at least 1", SubgraphMaxResults)
+	}
+	SubgraphPageSize = getEnvInt("subgraph_page_size", clients.DefaultPageSize)
+	if SubgraphPageSize < 1 || SubgraphPageSize > clients.DefaultPageSize {
+		log.Fatalf("Invalid subgraph_page_size: %d, expected 1 to %d", SubgraphPageSize, clients.DefaultPageSize)
+	}
+	SubgraphMaxPages = getEnvInt("subgraph_max_pages", clients.DefaultMaxPages)
+	if SubgraphMaxPages < 1 {
+		log.Fatalf("Invalid subgraph_max_pages: %d, expected at least 1", SubgraphMaxPages)
+	}
+	SubgraphLatestOrderBy = getEnvDefault("subgraph_latest_order_by", clients.DefaultLatestOrderBy)
+	if SubgraphLatestOrderBy != "nonce" && SubgraphLatestOrderBy != "block" {
+		log.Fatalf("Invalid subgraph_latest_order_by: %q, expected nonce or block", SubgraphLatestOrderBy)
+	}
+	SubgraphLatestOrderDirection = getEnvDefault("subgraph_latest_order_direction", clients.DefaultLatestOrderDirection)
+	if SubgraphLatestOrderDirection != "desc" && SubgraphLatestOrderDirection != "asc" {
+		log.Fatalf("Invalid subgraph_latest_order_direction: %q, expected desc or asc", SubgraphLatestOrderDirection)
+	}
+	SubgraphRps = getEnvFloat("subgraph_rps", 0)
+	SubgraphBurst = getEnvInt("subgraph_burst", 1)
+	if SubgraphRps < 0 || SubgraphBurst < 1 {
+		log.Fatalf("Invalid subgraph rate limit: subgraph_rps (%g) must be non-negative and subgraph_burst (%d) at least 1", SubgraphRps, SubgraphBurst)
+	}
+	SubgraphApiKey = os.Getenv("subgraph_api_key")
+	SubgraphHeaders, err = parseHeaders(os.Getenv("subgraph_headers"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func getEnvDefault(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvFloat(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s: %q, expected a number", name, value)
+	}
+	return number
+}
+
+func getEnvInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %q, expected an integer", name, value)
+	}
+	return number
+}
+
+func getEnvBool(name string) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %q, expected true or false", name, value)
+	}
+	return enabled
+}
+
+var requiredEnv = []string{"ethereum_rpc_url", "polygon_sub_graph_url", "heimdall_rest_url", "heimdall_chain_id"}
+
+// validateRequiredEnv reports every required variable that is unset or empty
+// in a single error.
+func validateRequiredEnv() error {
+	var missing []string
+	for _, name := range requiredEnv {
+		if strings.TrimSpace(os.Getenv(name)) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// getEnvSeconds reads a non-negative number of seconds from the environment,
+// returning fallback when the variable is unset.
+func getEnvSeconds(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		log.Fatalf("Invalid %s: %q, expected a non-negative number of seconds", name, value)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// parsePollInterval parses poll_interval_seconds, a positive number of
+// seconds defaulting to 18.
+func parsePollInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return 18 * time.Second, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid poll_interval_seconds: %q, expected a positive number of seconds", value)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseArgs splits a command line argument list given either as a JSON array,
+// for arguments containing spaces, or separated by whitespace.
+func parseArgs(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") {
+		return strings.Fields(value), nil
+	}
+
+	var args []string
+	if err := json.Unmarshal([]byte(value), &args); err != nil {
+		return nil, fmt.Errorf("invalid argument list %q: %v", value, err)
+	}
+	return args, nil
+}
+
+// parseHeaders parses semicolon separated `Name: value` entries.
+func parseHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected Name: value", entry)
+		}
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return headers, nil
+}
+
+func parseFeatures(value string) (map[string]bool, error) {
+	features := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(knownFeatures, name) {
+			return nil, fmt.Errorf("unknown feature %q, expected one of %s", name, strings.Join(knownFeatures, ", "))
+		}
+		features[name] = true
+	}
+	return features, nil
+}
+
+func featureEnabled(name string) bool {
+	return Features[name]
+}
+
+func enabledFeatures() []string {
+	names := make([]string, 0, len(Features))
+	for name := range Features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// validatorConfig is a validator entry of the -config file. Unset overrides
+// fall back to the env configuration.
+type validatorConfig struct {
+	ID                   int      `json:"id"`
+	MinBlockAgeSeconds   *int     `json:"min_block_age_seconds,omitempty"`
+	PollIntervalSeconds  *int     `json:"poll_interval_seconds,omitempty"`
+	HeimdallcliExtraArgs []string `json:"heimdallcli_extra_args,omitempty"`
+	// Profile names the profile whose deployments the validator uses, the
+	// env configuration when empty.
+	Profile string `json:"profile,omitempty"`
+}
+
+// profileConfig is a profile of the -config file, a deployment of the
+// subgraph, Heimdall and Ethereum its validators use instead of the ones of
+// the env configuration.
+type profileConfig struct {
+	// SubgraphURL is a comma separated list like polygon_sub_graph_url.
+	SubgraphURL        string         `json:"subgraph_url"`
+	HeimdallRestURL    string         `json:"heimdall_rest_url"`
+	HeimdallChainID    string         `json:"heimdall_chain_id"`
+	EthereumRPCURL     string         `json:"ethereum_rpc_url"`
+	StakingInfoAddress common.Address `json:"staking_info_address,omitempty"`
+	// HeimdallcliNode and HeimdallcliHome are the --node and --home of the
+	// heimdallcli runs of submit_mode exec, so each profile broadcasts
+	// through a node of its own deployment.
+	HeimdallcliNode string `json:"heimdallcli_node,omitempty"`
+	HeimdallcliHome string `json:"heimdallcli_home,omitempty"`
+}
+
+// fileConfig is the JSON file passed with -config, e.g.
+//
+//	{"validators": [{"id": 12}, {"id": 40, "poll_interval_seconds": 60}]}
+//
+// Validators on another deployment are assigned one of its profiles:
+//
+//	{"profiles": {"amoy": {...}}, "validators": [{"id": 12, "profile": "amoy"}]}
+type fileConfig struct {
+	Profiles   map[string]profileConfig `json:"profiles,omitempty"`
+	Validators []validatorConfig        `json:"validators"`
+}
+
+var (
+	// ConfigValidators are the validator ids listed in the -config file, in
+	// file order.
+	ConfigValidators []int
+	// validatorOverrides holds the per-validator settings of the file.
+	validatorOverrides = map[int]validatorConfig{}
+	// profileConfigs holds the profiles of the file by name.
+	profileConfigs = map[string]profileConfig{}
+)
+
+// loadConfigFile reads and validates the -config file.
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config fileConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&config); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	for name, profile := range config.Profiles {
+		if name == "" || name == defaultProfileName {
+			return fmt.Errorf("invalid config file %s: invalid profile name %q", path, name)
+		}
+		if err = profile.validate(); err != nil {
+			return fmt.Errorf("invalid config file %s: profile %s: %v", path, name, err)
+		}
+		// Without a node of its own, heimdallcli would broadcast the
+		// profile's txs through the node of the default profile.
+		if SubmitMode == "exec" && profile.HeimdallcliNode == "" && !sameURL(profile.HeimdallRestURL, HeimdallRestUrl) {
+			return fmt.Errorf("invalid config file %s: profile %s: heimdallcli_node is required with submit_mode exec, as its heimdall_rest_url differs from the default one", path, name)
+		}
+		profileConfigs[name] = profile
+	}
+	for _, validator := range config.Validators {
+		if validator.ID < 0 {
+			return fmt.Errorf("invalid config file %s: invalid validator id %d", path, validator.ID)
+		}
+		if _, ok := validatorOverrides[validator.ID]; ok {
+			return fmt.Errorf("invalid config file %s: validator %d is listed twice", path, validator.ID)
+		}
+		if validator.MinBlockAgeSeconds != nil && *validator.MinBlockAgeSeconds < 0 {
+			return fmt.Errorf("invalid config file %s: validator %d min_block_age_seconds must not be negative", path, validator.ID)
+		}
+		if validator.PollIntervalSeconds != nil && *validator.PollIntervalSeconds <= 0 {
+			return fmt.Errorf("invalid config file %s: validator %d poll_interval_seconds must be positive", path, validator.ID)
+		}
+		if _, ok := profileConfigs[validator.Profile]; validator.Profile != "" && !ok {
+			return fmt.Errorf("invalid config file %s: validator %d uses unknown profile %q", path, validator.ID, validator.Profile)
+		}
+		validatorOverrides[validator.ID] = validator
+		ConfigValidators = append(ConfigValidators, validator.ID)
+	}
+	return nil
+}
+
+func (p profileConfig) validate() error {
+	for name, value := range map[string]string{
+		"subgraph_url":      p.SubgraphURL,
+		"heimdall_rest_url": p.HeimdallRestURL,
+		"heimdall_chain_id": p.HeimdallChainID,
+		"ethereum_rpc_url":  p.EthereumRPCURL,
+	} {
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+	}
+	return nil
+}
+
+// envProfileConfig is the default profile, made of the env configuration.
+func envProfileConfig() profileConfig {
+	return profileConfig{
+		SubgraphURL:        strings.Join(PolygonSubGraphUrls, ","),
+		HeimdallRestURL:    HeimdallRestUrl,
+		HeimdallChainID:    HeimdallChainId,
+		EthereumRPCURL:     EthereumRPCUrl,
+		StakingInfoAddress: StakingInfoAddress,
+		HeimdallcliNode:    HeimdallcliNode,
+		HeimdallcliHome:    HeimdallcliHome,
+	}
+}
+
+func sameURL(a string, b string) bool {
+	return strings.TrimRight(strings.TrimSpace(a), "/") == strings.TrimRight(strings.TrimSpace(b), "/")
+}
+
+// validatorProfileName returns the name of the profile the validator is
+// assigned to.
+func validatorProfileName(validatorId int) string {
+	if name := validatorOverrides[validatorId].Profile; name != "" {
+		return name
+	}
+	return defaultProfileName
+}
+
+// validatorProfileConfig returns the profile the validator is assigned to,
+// the env configuration when it has none.
+func validatorProfileConfig(validatorId int) profileConfig {
+	if name := validatorOverrides[validatorId].Profile; name != "" {
+		return profileConfigs[name]
+	}
+	return envProfileConfig()
+}
+
+func validatorPollInterval(validatorId int) time.Duration {
+	if seconds := validatorOverrides[validatorId].PollIntervalSeconds; seconds != nil {
+		return time.Duration(*seconds) * time.Second
+	}
+	return PollInterval
+}
+
+func validatorMinBlockAge(validatorId int) time.Duration {
+	if seconds := validatorOverrides[validatorId].MinBlockAgeSeconds; seconds != nil {
+		return time.Duration(*seconds) * time.Second
+	}
+	return MinBlockAge
+}
+
+// validatorExtraArgs returns the --node and --home of the validator's
+// profile, then heimdallcli_extra_args followed by the validator's own extra
+// args, which heimdallcli lets override the earlier ones.
+func validatorExtraArgs(validatorId int) []string {
+	var args []string
+	config := validatorProfileConfig(validatorId)
+	if config.HeimdallcliNode != "" {
+		args = append(args, "--node", config.HeimdallcliNode)
+	}
+	if config.HeimdallcliHome != "" {
+		args = append(args, "--home", config.HeimdallcliHome)
+	}
+	args = append(args, HeimdallcliExtraArgs...)
+	return append(args, validatorOverrides[validatorId].HeimdallcliExtraArgs...)
+}
+
+// logMonitoredValidators logs every validator about to be watched, along
+// with its effective settings.
+func logMonitoredValidators(validatorIds []int) {
+	for _, validatorId := range validatorIds {
+		_, fromFile := validatorOverrides[validatorId]
+		validatorLogger(validatorId).Info("Monitoring validator",
+			"from_config_file", fromFile,
+			"poll_interval", validatorPollInterval(validatorId),
+			"min_block_age", validatorMinBlockAge(validatorId),
+			"profile", validatorProfileName(validatorId),
+			"heimdallcli_extra_args", validatorExtraArgs(validatorId))
+	}
+}
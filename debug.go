@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"stake-update-go/clients"
+)
+
+// debugState is the full internal state dumped by GET /debug/state.
+type debugState struct {
+	Validators  []validatorStatus `json:"validators"`
+	Submissions []SubmittedUpdate `json:"submissions"`
+	Draining    bool              `json:"draining"`
+	Paused      bool              `json:"paused"`
+	Breakers    map[string]string `json:"breakers"`
+	Features    []string          `json:"features"`
+	Caches      []profileCaches   `json:"caches"`
+}
+
+// profileCaches are the contents of the caches of a profile.
+type profileCaches struct {
+	Profile string `json:"profile"`
+	// Blocks is nil when block_cache_size disables the cache.
+	Blocks []clients.CachedBlock `json:"blocks"`
+	// HeadTime is the chain head time cached with freshness_source
+	// chainhead.
+	HeadTime          *time.Time `json:"headTime,omitempty"`
+	HeadTimeFetchedAt *time.Time `json:"headTimeFetchedAt,omitempty"`
+	// BatchNonces is set with the batch_nonce_queries feature.
+	BatchNonces          map[int]int `json:"batchNonces,omitempty"`
+	BatchNoncesFetchedAt *time.Time  `json:"batchNoncesFetchedAt,omitempty"`
+}
+
+func init() {
+	httpMux.HandleFunc("/debug/state", handleDebugState)
+}
+
+// handleDebugState dumps the internal state as pretty JSON. It requires
+// `Authorization: Bearer <debug_auth_token>` and is disabled when no token is
+// configured. Each part is copied under its own lock, so it never races the
+// loop updating it.
+func handleDebugState(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state := debugState{
+		Validators:  board.Snapshot(),
+		Submissions: stateStore.Entries(),
+		Draining:    drain.Draining(),
+		Paused:      pause.Paused(),
+		Breakers:    breakerStates(),
+		Features:    enabledFeatures(),
+	}
+	for _, p := range allProfiles() {
+		caches := profileCaches{Profile: p.Name}
+		if cached, ok := p.Blocks.(*clients.CachedBlocks); ok {
+			caches.Blocks = cached.Entries()
+		}
+		headTime, headTimeFetchedAt := p.headTime.snapshot()
+		caches.HeadTime, caches.HeadTimeFetchedAt = optionalTime(headTime), optionalTime(headTimeFetchedAt)
+		if p.nonceBatch != nil {
+			var fetchedAt time.Time
+			caches.BatchNonces, fetchedAt = p.nonceBatch.snapshot()
+			caches.BatchNoncesFetchedAt = optionalTime(fetchedAt)
+		}
+		state.Caches = append(state.Caches, caches)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(state)
+}
+
+// optionalTime returns nil for the zero time, so it is left out of the dump.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// authorizeAdmin checks the debug_auth_token bearer token of the admin
+// endpoints, which are disabled when no token is configured. It writes the
+// error response and returns false when the request may not go ahead.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if DebugAuthToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	expected := "Bearer " + DebugAuthToken
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// WatchAll makes watch mode watch every validator of the Heimdall validator
+// set, set by -all.
+var WatchAll bool
+
+// discoverValidators returns the ids of the current Heimdall validator set.
+// An empty set is an error, as it is far more likely a broken endpoint than
+// a network without validators.
+func discoverValidators(ctx context.Context) ([]int, error) {
+	validatorIds, err := defaultProfile.Heimdall.ValidatorSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(validatorIds) == 0 {
+		return nil, errors.New("the Heimdall validator set is empty")
+	}
+	return validatorIds, nil
+}
+
+// runDiscovery re-reads the validator set every interval, starting a worker
+// for every validator that joined and stopping the ones of validators that
+// left. Validators given explicitly are always kept.
+func runDiscovery(ctx context.Context, pool *workerPool, explicit map[int]bool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-drain.ch:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		discovered, err := discoverValidators(ctx)
+		if err != nil {
+			slog.Warn("Unable to refresh the validator set, keeping the current one", "err", err)
+			continue
+		}
+		inSet := map[int]bool{}
+		for _, validatorId := range discovered {
+			inSet[validatorId] = true
+		}
+
+		running := pool.Running()
+		var joined, left []int
+		for _, validatorId := range discovered {
+			if !running[validatorId] {
+				joined = append(joined, validatorId)
+			}
+		}
+		for validatorId := range running {
+			if !inSet[validatorId] && !explicit[validatorId] {
+				left = append(left, validatorId)
+			}
+		}
+		if len(joined) == 0 && len(left) == 0 {
+			slog.Debug("Validator set unchanged", "validators", len(discovered))
+			continue
+		}
+		slog.Info("Validator set changed", "joined", joined, "left", left, "validators", len(discovered))
+
+		for _, validatorId := range left {
+			validatorLogger(validatorId).Info("Validator left the validator set, no longer watching it")
+			pool.Stop(validatorId)
+		}
+		if featureEnabled(featureBatchNonceQueries) {
+			watched := make([]int, 0, len(running)+len(joined))
+			for validatorId := range pool.Running() {
+				watched = append(watched, validatorId)
+			}
+			setupNonceBatches(append(watched, joined...), PollInterval/2)
+		}
+		logMonitoredValidators(joined)
+		for _, validatorId := range joined {
+			pool.Start(validatorId)
+		}
+	}
+}
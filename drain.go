@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// drainer lets the process stop picking up new submissions while the ones in
+// flight finish, for zero-gap rolling restarts.
+type drainer struct {
+	mu       sync.Mutex
+	draining bool
+	ch       chan struct{}
+	inflight sync.WaitGroup
+	waitOnce sync.Once
+}
+
+var drain = &drainer{ch: make(chan struct{})}
+
+func init() {
+	// Draining can't be undone, so it takes the debug_auth_token like
+	// /debug/state rather than being open to anyone who can scrape metrics.
+	httpMux.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeAdmin(w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		drain.Start("HTTP request from " + r.RemoteAddr)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// Start enters draining mode. Calling it again is a no-op.
+func (d *drainer) Start(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return
+	}
+	slog.Info("Draining started, no new submissions will be picked up", "reason", reason)
+	d.draining = true
+	close(d.ch)
+}
+
+func (d *drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// Begin registers a submission as in flight. It returns false once draining
+// has started, in which case the submission must not be attempted.
+func (d *drainer) Begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return false
+	}
+	d.inflight.Add(1)
+	return true
+}
+
+// End marks a submission registered with Begin as finished.
+func (d *drainer) End() {
+	d.inflight.Done()
+}
+
+// Sleep waits for duration, returning early if draining starts or ctx is
+// cancelled.
+func (d *drainer) Sleep(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-d.ch:
+	case <-ctx.Done():
+	}
+}
+
+// Wait blocks until all in-flight submissions finish or timeout elapses.
+// Concurrent callers share the first caller's wait.
+func (d *drainer) Wait(timeout time.Duration) {
+	d.waitOnce.Do(func() {
+		done := make(chan struct{})
+		go func() {
+			d.inflight.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			slog.Info("Draining complete, all in-flight submissions finished")
+		case <-time.After(timeout):
+			slog.Warn("Draining timed out with submissions still in flight", "timeout", timeout)
+		}
+	})
+}
+
+// handleSignals drains on the first SIGINT/SIGTERM and cancels once the
+// in-flight submissions finished or drain_timeout_seconds passed, so a
+// heimdallcli broadcast isn't killed halfway. A second signal exits at once.
+func handleSignals(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	sig := <-signals
+	slog.Info("Shutdown signal received, finishing in-flight submissions", "signal", sig.String(), "timeout", DrainTimeout)
+	drain.Start("signal " + sig.String())
+	go func() {
+		drain.Wait(DrainTimeout)
+		cancel()
+	}()
+
+	sig = <-signals
+	slog.Warn("Second shutdown signal received, exiting immediately", "signal", sig.String())
+	os.Exit(1)
+}
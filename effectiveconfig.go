@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"stake-update-go/clients"
+)
+
+// redacted replaces secrets in the effective configuration.
+const redacted = "***"
+
+// logEffectiveConfig logs the resolved configuration with secrets redacted,
+// so wrong URLs or chain ids are obvious from the first lines of output.
+func logEffectiveConfig() {
+	slog.Info("Effective configuration",
+		"network", Network,
+		"ethereum_rpc_host", urlHost(EthereumRPCUrl),
+		"polygon_sub_graph_url", redactURLs(PolygonSubGraphUrls),
+		"subgraph_api_key", redactSecret(SubgraphApiKey),
+		"subgraph_headers", strings.Join(headerNames(SubgraphHeaders), ","),
+		"heimdall_rest_url", clients.RedactURL(HeimdallRestUrl),
+		"heimdall_chain_id", HeimdallChainId,
+		"submit_mode", SubmitMode,
+		"heimdall_private_key", redactSecret(os.Getenv("heimdall_private_key")),
+		"poll_interval", PollInterval,
+		"min_block_age", MinBlockAge,
+		"freshness_source", FreshnessSource,
+		"confirmation_block_tag", ConfirmationBlockTag,
+		"block_conflict_action", BlockConflictAction,
+		"max_updates_per_cycle", MaxUpdatesPerCycle,
+		"min_submit_interval", MinSubmitInterval,
+		"submit_cooldown", SubmitCooldown,
+		"resubmit_after", ResubmitAfter,
+		"confirm_timeout", ConfirmTimeout,
+		"heimdallcli_breaker_failures", HeimdallcliBreakerFailures,
+		"verify_stake_event", VerifyStakeEvent,
+		"dry_run", DryRun,
+		"strict_mode", StrictMode,
+		"once", Once,
+		"state_file", StateFile,
+		"audit_file", AuditFile,
+		"metrics_addr", MetricsAddr,
+		"health_addr", HealthAddr,
+		"statsd_addr", StatsdAddr,
+		"debug_auth_token", redactSecret(DebugAuthToken),
+		"alert_webhook_url", redactSecret(AlertWebhookUrl),
+		"proxy_url", clients.RedactURL(ProxyUrl),
+		"features", strings.Join(enabledFeatures(), ","),
+	)
+
+	names := make([]string, 0, len(profileConfigs))
+	for name := range profileConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		profile := profileConfigs[name]
+		slog.Info("Effective profile configuration",
+			"profile", name,
+			"ethereum_rpc_host", urlHost(profile.EthereumRPCURL),
+			"subgraph_url", redactURLs(splitList(profile.SubgraphURL)),
+			"heimdall_rest_url", clients.RedactURL(profile.HeimdallRestURL),
+			"heimdall_chain_id", profile.HeimdallChainID,
+		)
+	}
+}
+
+// redactURLs joins urls with their credentials redacted.
+func redactURLs(urls []string) string {
+	redactedUrls := make([]string, len(urls))
+	for i, u := range urls {
+		redactedUrls[i] = clients.RedactURL(u)
+	}
+	return strings.Join(redactedUrls, ",")
+}
+
+// redactSecret returns *** for a set secret and an empty string otherwise,
+// so the log still shows whether it is configured.
+func redactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// urlHost returns only the host of rawUrl, as RPC URLs commonly carry the
+// provider key in their path.
+func urlHost(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || parsed.Host == "" {
+		return redacted
+	}
+	return parsed.Host
+}
+
+// headerNames lists the configured header names, their values may be
+// credentials.
+func headerNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
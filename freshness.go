@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// headTimeMaxAge is how long the chain head timestamp is reused, about one
+// Ethereum block.
+const headTimeMaxAge = 12 * time.Second
+
+// headTimeCache holds the chain head timestamp of a profile.
+type headTimeCache struct {
+	mu        sync.Mutex
+	headTime  time.Time
+	fetchedAt time.Time
+}
+
+// chainHeadTime returns the chain head timestamp, fetched again once it is
+// older than headTimeMaxAge.
+func (p *profile) chainHeadTime(ctx context.Context) (time.Time, error) {
+	cache := &p.headTime
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if !cache.fetchedAt.IsZero() && time.Since(cache.fetchedAt) < headTimeMaxAge {
+		return cache.headTime, nil
+	}
+
+	headTime, err := p.Blocks.HeadTime(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cache.headTime = headTime
+	cache.fetchedAt = time.Now()
+	return headTime, nil
+}
+
+// snapshot returns the cached head time and when it was fetched, both zero
+// before the first fetch.
+func (c *headTimeCache) snapshot() (time.Time, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.headTime, c.fetchedAt
+}
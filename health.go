@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// readiness tracks the startup steps /readyz waits for: the eth client dial
+// and the first Ethereum nonce fetch of every validator.
+type readiness struct {
+	mu      sync.Mutex
+	dialed  bool
+	pending map[int]bool
+}
+
+var ready = &readiness{pending: map[int]bool{}}
+
+// Expect registers the validators whose first nonce fetch is waited for.
+func (r *readiness) Expect(validatorIds []int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range validatorIds {
+		r.pending[id] = true
+	}
+}
+
+func (r *readiness) SetDialed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dialed = true
+}
+
+func (r *readiness) NonceFetched(validatorId int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, validatorId)
+}
+
+// Forget stops waiting for a validator that is no longer watched.
+func (r *readiness) Forget(validatorId int) {
+	r.NonceFetched(validatorId)
+}
+
+func (r *readiness) Ready() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dialed && len(r.pending) == 0
+}
+
+// healthy reports whether at least one cycle has succeeded and not every
+// validator has failed its last HealthMaxFailures cycles in a row.
+func healthy() bool {
+	statuses := board.Snapshot()
+	succeeded := false
+	for _, status := range statuses {
+		if !status.LastSuccess.IsZero() {
+			succeeded = true
+		}
+	}
+	if !succeeded {
+		return false
+	}
+	for _, status := range statuses {
+		if status.ConsecutiveFailures < HealthMaxFailures {
+			return true
+		}
+	}
+	return false
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !healthy() {
+		http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !ready.Ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// startHealthServer serves /healthz, /readyz and /status on addr. It is a
+// no-op when addr is empty, and shares the metrics server, which always
+// serves /status, when both use the same address.
+func startHealthServer(addr string) {
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	if addr == MetricsAddr {
+		mux = httpMux
+	}
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+	if addr == MetricsAddr {
+		return
+	}
+	mux.HandleFunc("/status", handleStatus)
+
+	go func() {
+		slog.Info("Serving health checks", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Health server stopped", "err", err)
+		}
+	}()
+}
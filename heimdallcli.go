@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"stake-update-go/watch"
+)
+
+// transientHeimdallcliErrors match heimdallcli failures caused by two
+// submissions landing too close together, which go away when the same
+// command is simply run again.
+var transientHeimdallcliErrors = regexp.MustCompile(`(?i)account sequence mismatch|already in mempool|mempool is full`)
+
+// runHeimdallcli runs heimdallcli with args, retrying up to HeimdallcliRetries
+// times when the output reports a transient error. Any other failure is
+// returned straight away. The last output is returned alongside the error.
+func runHeimdallcli(ctx context.Context, logger *slog.Logger, args []string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		output, err := execHeimdallcli(logger, args)
+		if err == nil {
+			return output, nil
+		}
+		if attempt >= HeimdallcliRetries || !transientHeimdallcliErrors.Match(output) {
+			return output, err
+		}
+
+		logger.Warn("Transient heimdallcli error, retrying", "attempt", attempt+1, "retries", HeimdallcliRetries, "err", err)
+		timer := time.NewTimer(HeimdallcliRetryDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return output, err
+		}
+	}
+}
+
+// execHeimdallcli runs heimdallcli once through the runner, which kills it
+// after HeimdallcliTimeout.
+func execHeimdallcli(logger *slog.Logger, args []string) ([]byte, error) {
+	output, err := runner.Run("heimdallcli", args...)
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Error("heimdallcli timed out and was killed", "timeout", HeimdallcliTimeout)
+		return output, fmt.Errorf("heimdallcli timeout after %s: %s", HeimdallcliTimeout, strings.TrimSpace(string(output)))
+	}
+	if err != nil {
+		return output, fmt.Errorf("heimdallcli failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return output, nil
+}
+
+// defaultCommandTemplate is the heimdallcli stake-update invocation used
+// unless heimdallcli_command_template overrides it.
+var defaultCommandTemplate = []string{"tx", "staking", "stake-update", "--block-number", "{block}", "--id", "{id}", "--log-index", "{logindex}", "--nonce", "{nonce}", "--staked-amount", "{staked}", "--tx-hash", "{txhash}", "--chain-id", "{chainid}"}
+
+// templatePlaceholder matches a {name} placeholder of the command template.
+var templatePlaceholder = regexp.MustCompile(`\{[a-z]+\}`)
+
+// templatePlaceholders are the placeholders a command template may use.
+var templatePlaceholders = map[string]bool{
+	"{block}": true, "{id}": true, "{nonce}": true, "{staked}": true,
+	"{txhash}": true, "{logindex}": true, "{chainid}": true,
+}
+
+// checkCommandTemplate fails on placeholders the template can't fill in, so
+// a typo shows at startup instead of as a rejected transaction.
+func checkCommandTemplate(template []string) error {
+	if len(template) == 0 {
+		return errors.New("the command template is empty")
+	}
+	for _, arg := range template {
+		for _, placeholder := range templatePlaceholder.FindAllString(arg, -1) {
+			if !templatePlaceholders[placeholder] {
+				return fmt.Errorf("unknown placeholder %s in %q", placeholder, arg)
+			}
+		}
+	}
+	return nil
+}
+
+// heimdallcliArgs builds the heimdallcli stake-update command for update by
+// rendering HeimdallcliCommandTemplate.
+func heimdallcliArgs(update StakeUpdate) []string {
+	validatorId, _ := strconv.Atoi(update.ValidatorID)
+	replacer := strings.NewReplacer(
+		"{block}", update.Block,
+		"{id}", update.ValidatorID,
+		"{nonce}", update.Nonce,
+		"{staked}", update.TotalStaked,
+		"{txhash}", update.TransactionHash,
+		"{logindex}", update.LogIndex,
+		"{chainid}", validatorProfileConfig(validatorId).HeimdallChainID,
+	)
+	args := make([]string, len(HeimdallcliCommandTemplate))
+	for i, arg := range HeimdallcliCommandTemplate {
+		args[i] = replacer.Replace(arg)
+	}
+	return append(args, validatorExtraArgs(validatorId)...)
+}
+
+// signerUpdateArgs builds the heimdallcli signer-update command for change.
+// heimdallcli_command_template only covers stake-updates.
+func signerUpdateArgs(change SignerChange) []string {
+	validatorId, _ := strconv.Atoi(change.ValidatorID)
+	args := []string{"tx", "staking", "signer-update",
+		"--id", change.ValidatorID,
+		"--new-pubkey", change.SignerPubKey,
+		"--tx-hash", change.TransactionHash,
+		"--log-index", change.LogIndex,
+		"--nonce", change.Nonce,
+		"--block-number", change.Block,
+		"--chain-id", validatorProfileConfig(validatorId).HeimdallChainID,
+	}
+	return append(args, validatorExtraArgs(validatorId)...)
+}
+
+// validatorExitArgs builds the heimdallcli validator-exit command for exit.
+func validatorExitArgs(exit ValidatorExit) []string {
+	validatorId, _ := strconv.Atoi(exit.ValidatorID)
+	args := []string{"tx", "staking", "validator-exit",
+		"--id", exit.ValidatorID,
+		"--deactivation-epoch", exit.DeactivationEpoch,
+		"--tx-hash", exit.TransactionHash,
+		"--log-index", exit.LogIndex,
+		"--nonce", exit.Nonce,
+		"--block-number", exit.Block,
+		"--chain-id", validatorProfileConfig(validatorId).HeimdallChainID,
+	}
+	return append(args, validatorExtraArgs(validatorId)...)
+}
+
+// eventArgs builds the heimdallcli command submitting event.
+func eventArgs(event watch.Event) []string {
+	switch event := event.(type) {
+	case watch.SignerChangeEvent:
+		return signerUpdateArgs(event.SignerChange)
+	case watch.ValidatorExitEvent:
+		return validatorExitArgs(event.ValidatorExit)
+	case watch.StakeUpdateEvent:
+		return heimdallcliArgs(event.StakeUpdate)
+	}
+	panic(fmt.Sprintf("no heimdallcli command for %T", event))
+}
+
+// execSubmitter submits stake-updates by running heimdallcli, the default
+// submit_mode.
+type execSubmitter struct{}
+
+func (execSubmitter) SubmitStakeUpdate(ctx context.Context, update StakeUpdate) error {
+	validatorId, _ := strconv.Atoi(update.ValidatorID)
+	logger := validatorLogger(validatorId).With("nonce", update.Nonce, "block", update.Block, "tx_hash", update.TransactionHash)
+	if err := update.Validate(); err != nil {
+		return err
+	}
+	_, err := runHeimdallcli(ctx, logger, heimdallcliArgs(update))
+	return err
+}
+
+func (execSubmitter) SubmitSignerUpdate(ctx context.Context, change SignerChange) error {
+	validatorId, _ := strconv.Atoi(change.ValidatorID)
+	logger := validatorLogger(validatorId).With("nonce", change.Nonce, "block", change.Block, "tx_hash", change.TransactionHash)
+	if err := change.Validate(); err != nil {
+		return err
+	}
+	_, err := runHeimdallcli(ctx, logger, signerUpdateArgs(change))
+	return err
+}
+
+func (execSubmitter) SubmitValidatorExit(ctx context.Context, exit ValidatorExit) error {
+	validatorId, _ := strconv.Atoi(exit.ValidatorID)
+	logger := validatorLogger(validatorId).With("nonce", exit.Nonce, "block", exit.Block, "tx_hash", exit.TransactionHash)
+	if err := exit.Validate(); err != nil {
+		return err
+	}
+	_, err := runHeimdallcli(ctx, logger, validatorExitArgs(exit))
+	return err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"stake-update-go/watch"
+)
+
+// Interactive asks the operator to confirm every submission on stdin.
+var Interactive bool
+
+var (
+	stdinOnce  sync.Once
+	stdinLines chan string
+	// promptMu serialises prompts, so the workers of several validators
+	// never interleave theirs and an answer always belongs to the prompt
+	// printed right above it.
+	promptMu sync.Mutex
+)
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// readStdinLines starts a single reader goroutine, so a prompt abandoned on
+// shutdown doesn't leave a stray reader racing the next one.
+func readStdinLines() <-chan string {
+	stdinOnce.Do(func() {
+		stdinLines = make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				stdinLines <- scanner.Text()
+			}
+			close(stdinLines)
+		}()
+	})
+	return stdinLines
+}
+
+// confirmSubmission prints the planned stake-update and waits for a y/n
+// answer. Anything but an explicit yes, including a drain, shutdown or closed
+// stdin, declines the submission.
+func confirmSubmission(ctx context.Context, stakeUpdate StakeUpdate) bool {
+	return promptConfirmation(ctx, func() {
+		fmt.Println("Planned stake-update :")
+		fmt.Println("  validator id  : ", stakeUpdate.ValidatorID)
+		fmt.Println("  nonce         : ", stakeUpdate.Nonce)
+		fmt.Println("  block number  : ", stakeUpdate.Block)
+		fmt.Println("  log index     : ", stakeUpdate.LogIndex)
+		fmt.Println("  staked amount : ", stakeUpdate.TotalStaked)
+		fmt.Println("  tx hash       : ", stakeUpdate.TransactionHash)
+		fmt.Print("Submit this stake-update? [y/N]: ")
+	})
+}
+
+// confirmSignerUpdate is confirmSubmission for a signer change.
+func confirmSignerUpdate(ctx context.Context, change SignerChange) bool {
+	return promptConfirmation(ctx, func() {
+		fmt.Println("Planned signer-update :")
+		fmt.Println("  validator id  : ", change.ValidatorID)
+		fmt.Println("  nonce         : ", change.Nonce)
+		fmt.Println("  block number  : ", change.Block)
+		fmt.Println("  log index     : ", change.LogIndex)
+		fmt.Println("  new signer    : ", change.NewSigner)
+		fmt.Println("  tx hash       : ", change.TransactionHash)
+		fmt.Print("Submit this signer-update? [y/N]: ")
+	})
+}
+
+// confirmValidatorExit is confirmSubmission for an unstake.
+func confirmValidatorExit(ctx context.Context, exit ValidatorExit) bool {
+	return promptConfirmation(ctx, func() {
+		fmt.Println("Planned validator-exit :")
+		fmt.Println("  validator id       : ", exit.ValidatorID)
+		fmt.Println("  nonce              : ", exit.Nonce)
+		fmt.Println("  block number       : ", exit.Block)
+		fmt.Println("  log index          : ", exit.LogIndex)
+		fmt.Println("  deactivation epoch : ", exit.DeactivationEpoch)
+		fmt.Println("  tx hash            : ", exit.TransactionHash)
+		fmt.Print("Submit this validator-exit? [y/N]: ")
+	})
+}
+
+// confirmEvent asks for the confirmation of the kind of event.
+func confirmEvent(ctx context.Context, event watch.Event) bool {
+	switch event := event.(type) {
+	case watch.SignerChangeEvent:
+		return confirmSignerUpdate(ctx, event.SignerChange)
+	case watch.ValidatorExitEvent:
+		return confirmValidatorExit(ctx, event.ValidatorExit)
+	case watch.StakeUpdateEvent:
+		return confirmSubmission(ctx, event.StakeUpdate)
+	}
+	return false
+}
+
+// promptConfirmation prints a prompt with show and reads the answer while
+// holding promptMu. A line typed before the prompt was printed is discarded
+// rather than taken as its answer.
+func promptConfirmation(ctx context.Context, show func()) bool {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	lines := readStdinLines()
+	for discarded := true; discarded; {
+		select {
+		case _, ok := <-lines:
+			discarded = ok
+		default:
+			discarded = false
+		}
+	}
+	show()
+	return readConfirmation(ctx, lines)
+}
+
+func readConfirmation(ctx context.Context, lines <-chan string) bool {
+	select {
+	case line, ok := <-lines:
+		if !ok {
+			return false
+		}
+		answer := strings.ToLower(strings.TrimSpace(line))
+		return answer == "y" || answer == "yes"
+	case <-drain.ch:
+		fmt.Println()
+		return false
+	case <-ctx.Done():
+		fmt.Println()
+		return false
+	}
+}
@@ -1,270 +1,455 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"math/big"
+	"log/slog"
 	"net/http"
 	"os"
-	"os/exec"
-	"strconv"
+	"strings"
 	"time"
 
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/joho/godotenv"
-)
-
-type ValidatorResponse struct {
-	Height string `json:"height"`
-	Result struct {
-		ID          int    `json:"ID"`
-		StartEpoch  int    `json:"startEpoch"`
-		EndEpoch    int    `json:"endEpoch"`
-		Nonce       int    `json:"nonce"`
-		Power       int    `json:"power"`
-		PubKey      string `json:"pubKey"`
-		Signer      string `json:"signer"`
-		LastUpdated string `json:"last_updated"`
-		Jailed      bool   `json:"jailed"`
-		Accum       int    `json:"accum"`
-	} `json:"result"`
-	Error string `json:"error"`
-}
-
-type StakeUpdateResponse struct {
-	Data struct {
-		StakeUpdates []struct {
-			ID              string `json:"id"`
-			ValidatorID     string `json:"validatorId"`
-			TotalStaked     string `json:"totalStaked"`
-			Block           string `json:"block"`
-			Nonce           string `json:"nonce"`
-			TransactionHash string `json:"transactionHash"`
-			LogIndex        string `json:"logIndex"`
-		} `json:"stakeUpdates"`
-	} `json:"data"`
-}
+	"stake-update-go/clients"
+	"stake-update-go/watch"
 
-var (
-	HeimdallRestUrl    string
-	PolygonSubGraphUrl string
-	HeimdallChainId    string
-	EthereumRPCUrl     string
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/time/rate"
 )
 
-var ethClient *ethclient.Client
+// StakeUpdate, SignerChange, ValidatorExit, ValidatorResponse and
+// SubmittedUpdate are aliased so the rest of the package keeps using the
+// short names.
+type (
+	StakeUpdate       = clients.StakeUpdate
+	SignerChange      = clients.SignerChange
+	ValidatorExit     = clients.ValidatorExit
+	ValidatorResponse = clients.ValidatorResponse
+	SubmittedUpdate   = watch.SubmittedUpdate
+)
 
 func init() {
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	EthereumRPCUrl = os.Getenv("ethereum_rpc_url")
-	PolygonSubGraphUrl = os.Getenv("polygon_sub_graph_url")
-	HeimdallRestUrl = os.Getenv("heimdall_rest_url")
-	HeimdallChainId = os.Getenv("heimdall_chain_id")
+	registerMode(&mode{
+		Name:        "watch",
+		Args:        "<validator_id>[,<validator_id>...]",
+		Description: "Keep submitting pending stake-updates for each validator as they appear on Ethereum",
+		Run:         runWatch,
+		Default:     true,
+	})
 }
 
 func main() {
-	validatorIdString := os.Args[1]
-	validatorId, err := strconv.Atoi(validatorIdString)
-	if err != nil {
-		log.Fatal("Invalid validator id")
+	listModes := flag.Bool("list-modes", false, "List the supported operating modes and exit")
+	version := flag.Bool("version", false, "Print the version and exit")
+	envFile := flag.String("env-file", ".env", "Path of the env file to load, variables already in the environment take precedence")
+	configFile := flag.String("config", "", "Path of a JSON file listing the validators to watch and their overrides")
+	flag.Var(&Validators, "validator", "Validator id to watch, may be repeated or comma separated")
+	dryRun := flag.Bool("dry-run", false, "Log the heimdallcli commands that would be run without executing them (env dry_run)")
+	flag.BoolVar(&Interactive, "interactive", false, "Prompt for confirmation on stdin before every submission")
+	flag.BoolVar(&Once, "once", false, "Submit the pending stake-updates a single time and exit, non-zero if any failed")
+	verbose := flag.Bool("verbose", false, "Log at debug level, including the subgraph and Heimdall request and response bodies (same as LOG_LEVEL=debug)")
+	recordCommands := flag.String("record-commands", "", "Write every heimdallcli command run, or that would be with -dry-run, to this file as JSON lines")
+	check := flag.Bool("check", false, "Check that the Ethereum RPC, subgraph, Heimdall and heimdallcli are reachable, then exit, non-zero if any isn't")
+	flag.BoolVar(&WatchAll, "all", false, "Also watch every validator of the Heimdall validator set, re-read every discovery_interval_seconds")
+	flag.IntVar(&MaxConsecutiveErrors, "max-consecutive-errors", 0, "Exit with code 3 once every validator failed this many cycles in a row, 0 to keep retrying forever")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *listModes {
+		printModes()
+		return
 	}
-
-	ethClient, err = ethclient.Dial(EthereumRPCUrl)
-	if err != nil {
-		log.Fatal(err)
+	if *version {
+		fmt.Println(versionString())
+		return
 	}
 
-	ethereumNonce, err := getEthereumValidatorNonce(validatorId)
-	if err != nil {
-		fmt.Println("Error getting ethereum nonce for validator: ", validatorId, err)
-		return
+	loadConfig(*envFile, flagSet("env-file"))
+	if *verbose {
+		if err := setupLogging("debug", getEnvDefault("LOG_FORMAT", "text")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile); err != nil {
+			log.Fatal(err)
+		}
 	}
+	slog.Info("Starting stake-update-go", "version", Version, "commit", Commit, "build_date", BuildDate)
+	if flagSet("dry-run") {
+		DryRun = *dryRun
+	}
+	logEffectiveConfig()
 
-	for {
-		heimdallNonce, err := getHeimdallValidatorNonce(validatorId)
-		if err != nil {
-			fmt.Println("Error getting heimdall nonce for validator: ", validatorId, err)
-			time.Sleep(1 * time.Second)
-			continue
+	if *recordCommands != "" {
+		var err error
+		if commandLog, err = openCommandRecorder(*recordCommands); err != nil {
+			log.Fatalf("Invalid -record-commands: %v", err)
 		}
+		defer commandLog.Close()
+	}
+	if AuditFile != "" {
+		var err error
+		if auditLog, err = openAuditTrail(AuditFile, AuditFileMaxBytes); err != nil {
+			log.Fatalf("Invalid audit_file: %v", err)
+		}
+		defer auditLog.Close()
+	}
 
-		fmt.Println("Ethereum nonce : ", ethereumNonce, " Heimdall nonce : ", heimdallNonce)
+	if err := setupMetrics(MetricsAddr, StatsdAddr); err != nil {
+		log.Fatalf("Invalid statsd_addr: %v", err)
+	}
 
-		if ethereumNonce > heimdallNonce {
-			err = processStakeUpdate(validatorId, heimdallNonce+1)
-			if err != nil {
-				fmt.Println("Error processing stake update for validator: ", validatorId, err)
-				time.Sleep(1 * time.Second)
-				continue
-			}
-		} else {
-			fmt.Println("No updates to process for validator: ", validatorId)
-			break
+	// ctx is cancelled once a SIGINT/SIGTERM drain has finished.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handleSignals(cancel)
+	go handlePauseSignals()
+
+	if *check {
+		if err := runSelfCheck(ctx); err != nil {
+			slog.Error("Exiting", "err", err)
+			os.Exit(1)
 		}
-		time.Sleep(18 * time.Second)
+		return
 	}
 
+	m, args := selectMode(flag.Args())
+	if err := m.Run(ctx, args); err != nil {
+		slog.Error("Exiting", "err", err)
+		if errors.Is(err, errStalled) {
+			os.Exit(exitStalled)
+		}
+		os.Exit(1)
+	}
 }
 
-func processStakeUpdate(validatorId int, nonce int) error {
-	fmt.Println("Processing stake update for validator : ", validatorId, " nonce : ", nonce)
-	data, err := querySubGraph(PolygonSubGraphUrl, getStakeUpdateQuery(validatorId, nonce))
-	if err != nil {
-		fmt.Println("Error getting stake update from subGraph for validator: ", validatorId, err)
-		return err
-	}
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
 
-	var response StakeUpdateResponse
-	err = json.Unmarshal(data, &response)
-	if err != nil {
-		fmt.Println("Error unmarshalling stake update for validator: ", validatorId, err)
-		return err
+func runWatch(ctx context.Context, args []string) error {
+	validatorIds := append(append([]int{}, ConfigValidators...), Validators...)
+	for _, arg := range args {
+		ids, err := parseValidatorIds(arg)
+		if err != nil {
+			return err
+		}
+		validatorIds = append(validatorIds, ids...)
+	}
+	validatorIds = uniqueValidatorIds(validatorIds)
+	if len(validatorIds) == 0 && !WatchAll {
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	stakeUpdate := response.Data.StakeUpdates[0]
+	if len(Features) > 0 {
+		slog.Info("Enabled features", "features", strings.Join(enabledFeatures(), ","))
+	}
+	if DryRun {
+		slog.Info("Dry run enabled, stake updates will not be submitted")
+	}
+	if SubmitMode == "rpc" {
+		slog.Info("Submitting through the Heimdall REST API", "from", crypto.PubkeyToAddress(HeimdallPrivateKey.PublicKey).Hex())
+	}
+	slog.Info("Minimum block age before submitting", "min_block_age", MinBlockAge, "freshness_source", FreshnessSource)
+	logMonitoredValidators(validatorIds)
+	if Interactive && !isTerminal(os.Stdin) {
+		return errors.New("-interactive requires stdin to be a terminal")
+	}
 
-	blockTime, err := getBlockTime(stakeUpdate.Block)
+	var err error
+	stateStore, err = loadState(StateFile)
 	if err != nil {
-		fmt.Println("Unable to get block time with err : ", err)
 		return err
 	}
+	for _, update := range stateStore.Entries() {
+		validatorLogger(update.ValidatorID).Info("Last submission from state file", "nonce", update.Nonce, "tx_hash", update.TxHash, "submitted_at", update.SubmittedAt)
+	}
 
-	if time.Since(blockTime) < time.Minute*10 {
-		fmt.Println("Block time is less than ten minutes, skipping stake-update")
-		return nil
+	startMetricsServer(MetricsAddr)
+	if ReconcileInterval > 0 {
+		if StateFile == "" {
+			return errors.New("reconcile_interval_seconds requires state_file to be set")
+		}
+		go runReconciler(ctx, ReconcileInterval)
+	}
+	if StatusInterval > 0 {
+		go runStatusSummary(StatusInterval)
+	}
+	if AlertWebhookUrl != "" {
+		alerts = newAlerter(AlertWebhookUrl, AlertAfterFailures)
+		go alerts.run(ctx)
 	}
 
-	fmt.Println("heimdallcli", "tx", "staking", "stake-update", "--block-number", stakeUpdate.Block, "--id", stakeUpdate.ValidatorID, "--log-index", stakeUpdate.LogIndex, "--nonce", stakeUpdate.Nonce, "--staked-amount", stakeUpdate.TotalStaked, "--tx-hash", stakeUpdate.TransactionHash, "--chain-id", HeimdallChainId)
-	err = exec.Command("heimdallcli", "tx", "staking", "stake-update", "--block-number", stakeUpdate.Block, "--id", stakeUpdate.ValidatorID, "--log-index", stakeUpdate.LogIndex, "--nonce", stakeUpdate.Nonce, "--staked-amount", stakeUpdate.TotalStaked, "--tx-hash", stakeUpdate.TransactionHash, "--chain-id", HeimdallChainId).Run()
-	if err != nil {
-		fmt.Println("Error running heimdallcli stake update for validator: ", validatorId, err)
+	startHealthServer(HealthAddr)
+	ready.Expect(validatorIds)
+	if err = setupClients(ctx); err != nil {
 		return err
 	}
-	fmt.Println("--------------------------------------------------------------------------------------------------------------------------")
-	return nil
-}
-
-func getHeimdallValidatorNonce(validatorId int) (int, error) {
-	// Giving mumbai heimdall, Make it configurabel in future
-	requestUrl := fmt.Sprintf("%s/staking/validator/%d", HeimdallRestUrl, validatorId)
-	response, err := http.Get(requestUrl)
-	if err != nil {
-		return 0, err
+	explicit := map[int]bool{}
+	for _, validatorId := range validatorIds {
+		explicit[validatorId] = true
 	}
-	defer response.Body.Close()
-	data, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return 0, err
+	if WatchAll {
+		discovered, err := discoverValidators(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to get the Heimdall validator set: %w", err)
+		}
+		var joined []int
+		for _, validatorId := range discovered {
+			if !explicit[validatorId] {
+				joined = append(joined, validatorId)
+			}
+		}
+		slog.Info("Watching the Heimdall validator set", "validators", len(discovered), "discovery_interval", DiscoveryInterval)
+		logMonitoredValidators(joined)
+		ready.Expect(joined)
+		validatorIds = append(validatorIds, joined...)
 	}
+	ready.SetDialed()
+	cycleSlots = newCycleLimiter(MaxConcurrentValidators)
+	if featureEnabled(featureBatchNonceQueries) {
+		// Half a poll interval, so every cycle of every worker shares one
+		// fresh batch.
+		setupNonceBatches(validatorIds, PollInterval/2)
+	}
+	go runSubgraphLagMonitor(ctx, PollInterval)
 
-	var responseData ValidatorResponse
-	err = json.Unmarshal(data, &responseData)
-	if err != nil {
-		return 0, err
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pool := newWorkerPool(ctx, newWatcher(), StartupJitter && !Once && (len(validatorIds) > 1 || WatchAll))
+	for _, validatorId := range validatorIds {
+		pool.Start(validatorId)
+	}
+	stalled := make(chan struct{})
+	if MaxConsecutiveErrors > 0 {
+		go watchStalled(ctx, pool, MaxConsecutiveErrors, stalled, cancel)
+	}
+	if WatchAll && !Once {
+		pool.Go(func() { runDiscovery(ctx, pool, explicit, DiscoveryInterval) })
 	}
 
-	if responseData.Error != "" {
-		return -1, nil
+	done := pool.Done()
+	select {
+	case <-done:
+	case <-drain.ch:
+		drain.Wait(DrainTimeout)
+	case <-ctx.Done():
+		<-done
 	}
 
-	return responseData.Result.Nonce, nil
+	if isClosed(stalled) {
+		return fmt.Errorf("%w: every validator failed %d cycles in a row", errStalled, MaxConsecutiveErrors)
+	}
+	failed := pool.Failed()
+	if Once && failed == len(validatorIds) {
+		slog.Info("Final status", "summary", board.Summary(time.Now()))
+		return fmt.Errorf("%w: all %d validators failed", errStalled, failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d validators stopped with errors", failed, len(validatorIds))
+	}
+	return nil
 }
 
-func getEthereumValidatorNonce(validatorId int) (int, error) {
-	data, err := querySubGraph(PolygonSubGraphUrl, getLatestNonceQuery(validatorId))
-	if err != nil {
-		return 0, err
+// errStalled is returned when no validator can make progress, and exits with
+// exitStalled so supervisors can tell it apart from other failures.
+var errStalled = errors.New("no progress")
+
+const exitStalled = 3
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
 	}
+}
 
-	var response StakeUpdateResponse
-	err = json.Unmarshal(data, &response)
-	if err != nil {
-		return 0, err
+// MaxConsecutiveErrors is the -max-consecutive-errors safety valve.
+var MaxConsecutiveErrors int
+
+// watchStalled closes stalled and cancels the workers once every validator
+// whose worker still runs has reported and failed maxErrors cycles in a row.
+// Validators retired or dropped from the -all set no longer count.
+func watchStalled(ctx context.Context, pool *workerPool, maxErrors int, stalled chan struct{}, cancel context.CancelFunc) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if allFailing(pool.Active(), board.Snapshot(), maxErrors) {
+			slog.Error("Every validator keeps failing, giving up", "max_consecutive_errors", maxErrors, "summary", board.Summary(time.Now()))
+			close(stalled)
+			cancel()
+			return
+		}
 	}
+}
 
-	if len(response.Data.StakeUpdates) == 0 {
-		return 0, nil
+// allFailing reports whether every active validator has a status with at
+// least maxErrors consecutive failures. A validator that hasn't reported yet
+// isn't failing.
+func allFailing(active map[int]bool, statuses []validatorStatus, maxErrors int) bool {
+	if len(active) == 0 {
+		return false
 	}
+	failing := 0
+	for _, status := range statuses {
+		if active[status.ValidatorID] && status.ConsecutiveFailures >= maxErrors {
+			failing++
+		}
+	}
+	return failing == len(active)
+}
 
-	latestValidatorNonce, err := strconv.Atoi(response.Data.StakeUpdates[0].Nonce)
+// Once makes watch mode run a single catch-up pass per validator and exit
+// instead of polling forever, for cron-driven operation.
+var Once bool
+
+func getHeimdallValidatorNonce(ctx context.Context, validatorId int) (int, error) {
+	validator, err := validatorProfile(validatorId).Heimdall.Validator(ctx, validatorId)
 	if err != nil {
 		return 0, err
 	}
+	return validator.Result.Nonce, nil
+}
 
-	return latestValidatorNonce, nil
+// dialEthBlocks dials the Ethereum RPC, retrying with backoff for up to
+// EthDialWindow so an endpoint that is briefly down at startup doesn't
+// crash-loop the process.
+func dialEthBlocks(ctx context.Context, rpcUrl string) (*clients.EthBlocks, error) {
+	deadline := time.Now().Add(EthDialWindow)
+	retry := newBackoff()
+	for attempt := 1; ; attempt++ {
+		blocksClient, err := clients.DialEthBlocks(ctx, rpcUrl, clients.NewHTTPClient(0, HTTPTransport))
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("Connected to the Ethereum RPC", "attempt", attempt)
+			}
+			blocksClient.OnReconnect = metrics.IncEthReconnects
+			return blocksClient, nil
+		}
+
+		delay := retry.Next()
+		if time.Now().Add(delay).After(deadline) {
+			return nil, fmt.Errorf("unable to dial the Ethereum RPC within %s: %w", EthDialWindow, err)
+		}
+		slog.Warn("Unable to dial the Ethereum RPC, retrying", "attempt", attempt, "retry_in", delay.Round(time.Millisecond), "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 }
 
-func getBlockTime(blockNumber string) (time.Time, error) {
-	blockBig, ok := big.NewInt(0).SetString(blockNumber, 10)
-	if !ok {
-		return time.Time{}, fmt.Errorf("invalid block number: %s", blockNumber)
+// setupClients wires the external services of every profile to the real
+// clients.
+func setupClients(ctx context.Context) error {
+	setupServiceClients()
+	for _, p := range allProfiles() {
+		if err := dialProfile(ctx, p, profileConfigOf(p)); err != nil {
+			return err
+		}
 	}
-	block, err := ethClient.BlockByNumber(context.Background(), blockBig)
-	if err != nil {
-		return time.Time{}, err
+	if proxyConfigured() {
+		checkProxyConnectivity(ctx)
 	}
-
-	return time.Unix(int64(block.Time()), 0), nil
+	return nil
 }
 
-// <------------------------------ GRAPH ----------------------------------->
-
-func querySubGraph(grapghUrl string, query []byte) (data []byte, err error) {
-	request, err := http.NewRequest("POST", grapghUrl, bytes.NewBuffer(query))
-	if err != nil {
-		return nil, err
+// setupServiceClients wires the subgraph, Heimdall and submission clients
+// of every profile, none of which connect before their first call.
+func setupServiceClients() {
+	runner = &clients.ExecRunner{Timeout: HeimdallcliTimeout}
+	for name := range profileConfigs {
+		if _, ok := profiles[name]; !ok {
+			profiles[name] = newProfile(name)
+		}
+	}
+	for _, p := range allProfiles() {
+		setupProfileServices(p, profileConfigOf(p))
 	}
+}
 
-	client := &http.Client{Timeout: time.Second * 10}
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, err
+func newSubgraphClient(urls []string) clients.Subgraph {
+	httpSubgraph := &clients.HTTPSubgraph{
+		URLs:       urls,
+		Client:     clients.NewHTTPClient(SubgraphTimeout, payloadLogger("subgraph", HTTPTransport)),
+		APIKey:     SubgraphApiKey,
+		Headers:    SubgraphHeaders,
+		MaxResults: SubgraphMaxResults,
+		PageSize:   SubgraphPageSize,
+		MaxPages:   SubgraphMaxPages,
+
+		LatestOrderBy:        SubgraphLatestOrderBy,
+		LatestOrderDirection: SubgraphLatestOrderDirection,
 	}
-	defer response.Body.Close()
+	if SubgraphRps > 0 {
+		httpSubgraph.Limiter = rate.NewLimiter(rate.Limit(SubgraphRps), SubgraphBurst)
+		httpSubgraph.OnThrottled = metrics.IncSubgraphThrottled
+	}
+	return httpSubgraph
+}
 
-	return ioutil.ReadAll(response.Body)
+func newHeimdallClient(restUrl string) clients.Heimdall {
+	return &clients.RESTHeimdall{URL: restUrl, Client: clients.NewHTTPClient(0, payloadLogger("heimdall", HeimdallTransport)), ValidatorPath: HeimdallValidatorPath, ValidatorSetPath: HeimdallValidatorSetPath}
 }
 
-func getLatestNonceQuery(validatorId int) []byte {
-	query := map[string]string{
-		"query": `
-		{
-			stakeUpdates(first:1, orderBy: nonce, orderDirection : desc, where: {validatorId: ` + strconv.Itoa(validatorId) + `}){
-				nonce
-		   } 
-		}   
-		`,
+// newSubmitter returns the submitter picked by submit_mode.
+func newSubmitter(restUrl string, chainId string) clients.Submitter {
+	if SubmitMode == "rpc" {
+		return &clients.RESTSubmitter{URL: restUrl, ChainID: chainId, Key: HeimdallPrivateKey, Client: clients.NewHTTPClient(30*time.Second, HeimdallTransport)}
 	}
+	return execSubmitter{}
+}
 
-	byteQuery, _ := json.Marshal(query)
-	return byteQuery
+// payloadLogger wraps transport to log request and response bodies while
+// debug logging is enabled.
+func payloadLogger(service string, transport http.RoundTripper) http.RoundTripper {
+	return &clients.PayloadLogger{Next: transport, Service: service, MaxBytes: LogPayloadMaxBytes}
 }
 
-func getStakeUpdateQuery(validatorId int, nonce int) []byte {
-	query := map[string]string{
-		"query": `
-		{
-			stakeUpdates(where: {validatorId: ` + strconv.Itoa(validatorId) + `, nonce: ` + strconv.Itoa(nonce) + `}){
-				id
-				validatorId
-				totalStaked
-				block
-				nonce
-				transactionHash
-				logIndex
-		   } 
-		}   
-		`,
-	}
-
-	byteQuery, _ := json.Marshal(query)
-	return byteQuery
+func proxyConfigured() bool {
+	if ProxyUrl != "" {
+		return true
+	}
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProxyConnectivity tries the subgraph and Heimdall once, so a proxy
+// that blocks them shows up at startup rather than as failing cycles. The
+// Ethereum RPC was already reached by dialing it.
+func checkProxyConnectivity(ctx context.Context) {
+	if _, err := defaultProfile.Subgraph.IndexedBlock(ctx); err != nil {
+		slog.Warn("Unable to reach the subgraph through the proxy", "err", err)
+	} else {
+		slog.Info("Reached the subgraph through the proxy")
+	}
+	if _, err := defaultProfile.Heimdall.Epoch(ctx); err != nil {
+		slog.Warn("Unable to reach Heimdall through the proxy", "err", err)
+	} else {
+		slog.Info("Reached Heimdall through the proxy")
+	}
 }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"stake-update-go/clients"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestParsePollInterval(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 18 * time.Second},
+		{value: "60", want: time.Minute},
+		{value: "1", want: time.Second},
+		{value: "0", wantErr: true},
+		{value: "-5", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "18s", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parsePollInterval(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parsePollInterval(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parsePollInterval(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+// setGlobal sets the package variable global to value until the test ends.
+func setGlobal[T any](t *testing.T, global *T, value T) {
+	t.Helper()
+	saved := *global
+	*global = value
+	t.Cleanup(func() { *global = saved })
+}
+
+// recordingRunner stands in for heimdallcli, recording every command run.
+type recordingRunner struct {
+	commands [][]string
+}
+
+func (r *recordingRunner) Run(name string, args ...string) ([]byte, error) {
+	r.commands = append(r.commands, append([]string{name}, args...))
+	return []byte("ok"), nil
+}
+
+// testBlocks serves a single block as the chain head.
+type testBlocks struct {
+	block *types.Block
+}
+
+func (b testBlocks) Block(ctx context.Context, blockNumber string) (*types.Block, error) {
+	if blockNumber != b.block.Number().String() {
+		return nil, fmt.Errorf("block %s not found", blockNumber)
+	}
+	return b.block, nil
+}
+
+func (b testBlocks) Head(ctx context.Context, tag string) (uint64, error) {
+	return b.block.NumberU64(), nil
+}
+
+func (b testBlocks) HeadTime(ctx context.Context) (time.Time, error) {
+	return time.Unix(int64(b.block.Time()), 0), nil
+}
+
+func (b testBlocks) Receipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return nil, fmt.Errorf("no receipt for %s", txHash.Hex())
+}
+
+func (b testBlocks) Logs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return nil, nil
+}
+
+// testHasher stands in for the trie hasher, the roots of the test block
+// never being checked.
+type testHasher struct{}
+
+func (testHasher) Reset()                {}
+func (testHasher) Update([]byte, []byte) {}
+func (testHasher) Hash() common.Hash     { return common.Hash{} }
+
+// TestWatchCycleRunsHeimdallcli drives one cycle of validator 7 against
+// stubbed subgraph and Heimdall servers, asserting the heimdallcli commands
+// it runs.
+func TestWatchCycleRunsHeimdallcli(t *testing.T) {
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	header := &types.Header{Number: big.NewInt(104), Time: uint64(time.Now().Add(-time.Hour).Unix())}
+	block := types.NewBlock(header, []*types.Transaction{tx}, nil, nil, testHasher{})
+	txHash := tx.Hash().Hex()
+	stakeUpdate := fmt.Sprintf(`{"id":"%s-0","validatorId":"7","totalStaked":"1000000000000000000000","block":"104","nonce":"4","transactionHash":"%s","logIndex":"0"}`, txHash, txHash)
+	wantArgs := []string{"heimdallcli", "tx", "staking", "stake-update",
+		"--block-number", "104", "--id", "7", "--log-index", "0", "--nonce", "4",
+		"--staked-amount", "1000000000000000000000", "--tx-hash", txHash, "--chain-id", "heimdall-137"}
+
+	tests := []struct {
+		name           string
+		stakeUpdates   string
+		heimdallStatus int
+		heimdallBody   string
+		wantCommands   [][]string
+		wantErr        bool
+	}{
+		{
+			name:           "lag",
+			stakeUpdates:   "[" + stakeUpdate + "]",
+			heimdallStatus: http.StatusOK,
+			heimdallBody:   `{"height":"1","result":{"ID":7,"nonce":3,"power":10}}`,
+			wantCommands:   [][]string{wantArgs},
+		},
+		{
+			name:           "no lag",
+			stakeUpdates:   "[" + stakeUpdate + "]",
+			heimdallStatus: http.StatusOK,
+			heimdallBody:   `{"height":"1","result":{"ID":7,"nonce":4,"power":10}}`,
+		},
+		{
+			name:           "empty result",
+			stakeUpdates:   "[]",
+			heimdallStatus: http.StatusOK,
+			heimdallBody:   `{"height":"1","result":{"ID":7,"nonce":3,"power":10}}`,
+		},
+		{
+			name:           "heimdall error response",
+			stakeUpdates:   "[" + stakeUpdate + "]",
+			heimdallStatus: http.StatusInternalServerError,
+			heimdallBody:   "<html>internal error</html>",
+			wantErr:        true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subgraph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				query := string(body)
+				switch {
+				case strings.Contains(query, "v7: stakeUpdates"):
+					fmt.Fprint(w, `{"data":{"v7":[{"nonce":"4","block":"104","logIndex":"0"}],"v7_signer":[],"v7_unstake":[]}}`)
+				case strings.Contains(query, "stakeUpdates("):
+					fmt.Fprintf(w, `{"data":{"stakeUpdates":%s}}`, test.stakeUpdates)
+				case strings.Contains(query, "signerChanges("):
+					fmt.Fprint(w, `{"data":{"signerChanges":[]}}`)
+				case strings.Contains(query, "unstakeInits("):
+					fmt.Fprint(w, `{"data":{"unstakeInits":[]}}`)
+				default:
+					fmt.Fprint(w, `{"data":{"_meta":{"block":{"number":104}}}}`)
+				}
+			}))
+			defer subgraph.Close()
+			heimdall := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/staking/validator/7" {
+					http.NotFound(w, r)
+					return
+				}
+				w.WriteHeader(test.heimdallStatus)
+				fmt.Fprint(w, test.heimdallBody)
+			}))
+			defer heimdall.Close()
+
+			transport, _ := clients.NewTransport("")
+			setGlobal(t, &HTTPTransport, transport)
+			setGlobal(t, &HeimdallTransport, transport)
+			setGlobal(t, &PolygonSubGraphUrls, []string{subgraph.URL})
+			setGlobal(t, &HeimdallRestUrl, heimdall.URL)
+			setGlobal(t, &HeimdallChainId, "heimdall-137")
+			setGlobal(t, &HeimdallcliCommandTemplate, defaultCommandTemplate)
+			setGlobal(t, &SubmitMode, "exec")
+			setGlobal(t, &ConfirmationBlockTag, "latest")
+			setGlobal(t, &MinBlockAge, 10*time.Minute)
+			setGlobal(t, &MaxUpdatesPerCycle, 10)
+			setGlobal(t, &Once, true)
+			setGlobal(t, &defaultProfile, newProfile(defaultProfileName))
+			setupProfileServices(defaultProfile, envProfileConfig())
+			defaultProfile.Blocks = testBlocks{block: block}
+			recorder := &recordingRunner{}
+			setGlobal[clients.Runner](t, &runner, recorder)
+
+			err := newWatcher().Watch(context.Background(), 7)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Watch = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(recorder.commands, test.wantCommands) {
+				t.Errorf("ran %q, want %q", recorder.commands, test.wantCommands)
+			}
+		})
+	}
+}
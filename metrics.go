@@ -0,0 +1,486 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stake-update-go/watch"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsSink is implemented by every metrics backend. Call sites record
+// through the package-level metrics value so backends can be enabled
+// independently of each other.
+type metricsSink interface {
+	SetNonces(validatorId int, ethereumNonce int, heimdallNonce int)
+	SetNonceLag(validatorId int, lag int)
+	IncSubmitted(validatorId int)
+	IncErrors(validatorId int)
+	IncHeimdallcliFailures(validatorId int)
+	IncSubgraphFailures(validatorId int)
+	ObserveSubmitDuration(validatorId int, duration time.Duration)
+	IncReconcileMismatch(validatorId int)
+	SetLastPollSuccess(validatorId int, at time.Time)
+	SetLastSubmit(validatorId int, at time.Time)
+	// SetLastError records when the validator's last failed cycle was, zero
+	// once a cycle succeeded again.
+	SetLastError(validatorId int, at time.Time)
+	// ObserveCatchUpDuration records how long Heimdall took to catch up
+	// after Ethereum was first seen ahead of it.
+	ObserveCatchUpDuration(validatorId int, duration time.Duration)
+	// SetBelowMinPower records whether the validator is skipped for having
+	// less than min_power.
+	SetBelowMinPower(validatorId int, below bool)
+	// IncPendingFinality counts stake-updates held back because their block
+	// is too recent.
+	IncPendingFinality(validatorId int)
+	// IncPanics counts panics recovered in the validator's worker.
+	IncPanics(validatorId int)
+	// IncSubgraphThrottled counts subgraph requests that had to wait for the
+	// rate limiter.
+	IncSubgraphThrottled()
+	// IncSubgraphMiss counts nonces missing from the subgraph, by cause:
+	// indexing_lag or absent.
+	IncSubgraphMiss(validatorId int, cause string)
+	// IncEthReconnects counts re-dials of the Ethereum RPC.
+	IncEthReconnects()
+	// SetPaused records whether submissions are paused.
+	SetPaused(paused bool)
+	// SetBreakerState records the state of a profile's submission circuit
+	// breaker.
+	SetBreakerState(profile string, state breakerState)
+	// SetSubgraphLag records how many blocks the subgraph is behind the
+	// Ethereum head.
+	SetSubgraphLag(blocks int64)
+	// RemoveValidator drops every series of a validator that is no longer
+	// watched.
+	RemoveValidator(validatorId int)
+}
+
+// multiSink fans every call out to all configured backends.
+type multiSink []metricsSink
+
+func (m multiSink) SetNonces(validatorId int, ethereumNonce int, heimdallNonce int) {
+	for _, sink := range m {
+		sink.SetNonces(validatorId, ethereumNonce, heimdallNonce)
+	}
+}
+
+func (m multiSink) SetNonceLag(validatorId int, lag int) {
+	for _, sink := range m {
+		sink.SetNonceLag(validatorId, lag)
+	}
+}
+
+func (m multiSink) IncSubmitted(validatorId int) {
+	for _, sink := range m {
+		sink.IncSubmitted(validatorId)
+	}
+}
+
+func (m multiSink) IncErrors(validatorId int) {
+	for _, sink := range m {
+		sink.IncErrors(validatorId)
+	}
+}
+
+func (m multiSink) IncHeimdallcliFailures(validatorId int) {
+	for _, sink := range m {
+		sink.IncHeimdallcliFailures(validatorId)
+	}
+}
+
+func (m multiSink) IncSubgraphFailures(validatorId int) {
+	for _, sink := range m {
+		sink.IncSubgraphFailures(validatorId)
+	}
+}
+
+func (m multiSink) ObserveSubmitDuration(validatorId int, duration time.Duration) {
+	for _, sink := range m {
+		sink.ObserveSubmitDuration(validatorId, duration)
+	}
+}
+
+func (m multiSink) IncReconcileMismatch(validatorId int) {
+	for _, sink := range m {
+		sink.IncReconcileMismatch(validatorId)
+	}
+}
+
+func (m multiSink) SetLastPollSuccess(validatorId int, at time.Time) {
+	for _, sink := range m {
+		sink.SetLastPollSuccess(validatorId, at)
+	}
+}
+
+func (m multiSink) SetLastSubmit(validatorId int, at time.Time) {
+	for _, sink := range m {
+		sink.SetLastSubmit(validatorId, at)
+	}
+}
+
+func (m multiSink) SetLastError(validatorId int, at time.Time) {
+	for _, sink := range m {
+		sink.SetLastError(validatorId, at)
+	}
+}
+
+func (m multiSink) ObserveCatchUpDuration(validatorId int, duration time.Duration) {
+	for _, sink := range m {
+		sink.ObserveCatchUpDuration(validatorId, duration)
+	}
+}
+
+func (m multiSink) SetBelowMinPower(validatorId int, below bool) {
+	for _, sink := range m {
+		sink.SetBelowMinPower(validatorId, below)
+	}
+}
+
+func (m multiSink) IncPendingFinality(validatorId int) {
+	for _, sink := range m {
+		sink.IncPendingFinality(validatorId)
+	}
+}
+
+func (m multiSink) IncPanics(validatorId int) {
+	for _, sink := range m {
+		sink.IncPanics(validatorId)
+	}
+}
+
+func (m multiSink) IncSubgraphMiss(validatorId int, cause string) {
+	for _, sink := range m {
+		sink.IncSubgraphMiss(validatorId, cause)
+	}
+}
+
+func (m multiSink) IncSubgraphThrottled() {
+	for _, sink := range m {
+		sink.IncSubgraphThrottled()
+	}
+}
+
+func (m multiSink) IncEthReconnects() {
+	for _, sink := range m {
+		sink.IncEthReconnects()
+	}
+}
+
+func (m multiSink) SetPaused(paused bool) {
+	for _, sink := range m {
+		sink.SetPaused(paused)
+	}
+}
+
+func (m multiSink) SetBreakerState(profile string, state breakerState) {
+	for _, sink := range m {
+		sink.SetBreakerState(profile, state)
+	}
+}
+
+func (m multiSink) SetSubgraphLag(blocks int64) {
+	for _, sink := range m {
+		sink.SetSubgraphLag(blocks)
+	}
+}
+
+func (m multiSink) RemoveValidator(validatorId int) {
+	for _, sink := range m {
+		sink.RemoveValidator(validatorId)
+	}
+}
+
+var metrics metricsSink = multiSink{}
+
+// setupMetrics enables the Prometheus backend when metricsAddr is set and the
+// StatsD backend when statsdAddr is set. main calls it before starting the
+// signal handlers, so metrics is never reassigned while they report to it.
+// The Prometheus backend is served by startMetricsServer.
+func setupMetrics(metricsAddr string, statsdAddr string) error {
+	var sinks multiSink
+	if metricsAddr != "" {
+		sinks = append(sinks, newPrometheusSink())
+	}
+	if statsdAddr != "" {
+		sink, err := newStatsdSink(statsdAddr)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	metrics = sinks
+	return nil
+}
+
+type prometheusSink struct {
+	ethereumNonce     *prometheus.GaugeVec
+	heimdallNonce     *prometheus.GaugeVec
+	nonceLag          *prometheus.GaugeVec
+	submitted         *prometheus.CounterVec
+	errors            *prometheus.CounterVec
+	heimdallcliFails  *prometheus.CounterVec
+	subgraphFails     *prometheus.CounterVec
+	submitDuration    *prometheus.HistogramVec
+	reconcileMismatch *prometheus.CounterVec
+	lastPollSuccess   *prometheus.GaugeVec
+	lastSubmit        *prometheus.GaugeVec
+	lastError         *prometheus.GaugeVec
+	pendingFinality   *prometheus.CounterVec
+	panics            *prometheus.CounterVec
+	subgraphMisses    *prometheus.CounterVec
+	catchUpDuration   *prometheus.HistogramVec
+	belowMinPower     *prometheus.GaugeVec
+	subgraphLag       prometheus.Gauge
+	subgraphThrottled prometheus.Counter
+	ethReconnects     prometheus.Counter
+	paused            prometheus.Gauge
+	breakerState      *prometheus.GaugeVec
+}
+
+func newPrometheusSink() *prometheusSink {
+	labels := []string{"validator_id"}
+	sink := &prometheusSink{
+		ethereumNonce: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stake_update_ethereum_nonce",
+			Help: "Latest validator nonce seen on Ethereum through the subgraph.",
+		}, labels),
+		heimdallNonce: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stake_update_heimdall_nonce",
+			Help: "Current validator nonce on Heimdall.",
+		}, labels),
+		nonceLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stake_update_nonce_lag",
+			Help: "Ethereum nonce minus Heimdall nonce.",
+		}, labels),
+		submitted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stake_update_submitted_total",
+			Help: "Stake-updates submitted to Heimdall.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stake_update_errors_total",
+			Help: "Failed polling or submission cycles.",
+		}, labels),
+		heimdallcliFails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stake_update_heimdallcli_failures_total",
+			Help: "heimdallcli invocations that failed.",
+		}, labels),
+		subgraphFails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stake_update_subgraph_failures_total",
+			Help: "Subgraph queries that failed.",
+		}, labels),
+		submitDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "stake_update_submit_duration_seconds",
+			Help:    "Time taken by heimdallcli to submit a stake-update.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 8),
+		}, labels),
+		reconcileMismatch: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stake_update_reconcile_mismatch_total",
+			Help: "Submitted stake-updates whose nonce is not reflected on Heimdall.",
+		}, labels),
+		lastPollSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stake_update_last_poll_success_timestamp_seconds",
+			Help: "Unix time of the last successful nonce poll.",
+		}, labels),
+		lastSubmit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stake_update_last_submit_timestamp_seconds",
+			Help: "Unix time of the last successful stake-update submission.",
+		}, labels),
+		lastError: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stake_update_last_error_timestamp_seconds",
+			Help: "Unix time of the validator's last failed cycle, 0 once a cycle succeeded again.",
+		}, labels),
+		pendingFinality: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stake_update_pending_finality_total",
+			Help: "Stake-updates held back because their block was too recent.",
+		}, labels),
+		subgraphMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stake_update_subgraph_misses_total",
+			Help: "Nonces missing from the subgraph, by cause: indexing_lag or absent.",
+		}, []string{"validator_id", "cause"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stake_update_worker_panics_total",
+			Help: "Panics recovered in the validator's worker, which was restarted.",
+		}, labels),
+		catchUpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "stake_update_catch_up_duration_seconds",
+			Help:    "Time from Ethereum first being ahead of Heimdall until Heimdall caught up.",
+			Buckets: prometheus.ExponentialBuckets(60, 2, 10),
+		}, labels),
+		belowMinPower: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stake_update_below_min_power",
+			Help: "1 while the validator is skipped for having less than min_power.",
+		}, labels),
+		subgraphLag: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "stake_update_subgraph_lag_blocks",
+			Help: "Ethereum head minus the latest block indexed by the subgraph.",
+		}),
+		subgraphThrottled: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "stake_update_subgraph_throttled_total",
+			Help: "Subgraph requests delayed by the subgraph_rps rate limit.",
+		}),
+		ethReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "stake_update_eth_reconnects_total",
+			Help: "Re-dials of the Ethereum RPC after a connection error.",
+		}),
+		paused: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "stake_update_paused",
+			Help: "1 while submissions are paused by SIGUSR1 or pause_file, 0 otherwise.",
+		}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stake_update_heimdallcli_breaker_state",
+			Help: "State of a profile's submission circuit breaker: 0 closed, 1 open, 2 half-open.",
+		}, []string{"profile"}),
+	}
+	prometheus.MustRegister(
+		sink.ethereumNonce, sink.heimdallNonce, sink.nonceLag,
+		sink.submitted, sink.errors, sink.heimdallcliFails, sink.subgraphFails,
+		sink.submitDuration, sink.reconcileMismatch, sink.lastPollSuccess, sink.lastSubmit, sink.lastError,
+		sink.pendingFinality, sink.panics, sink.subgraphMisses, sink.catchUpDuration, sink.belowMinPower, sink.subgraphLag, sink.subgraphThrottled,
+		sink.ethReconnects, sink.paused, sink.breakerState,
+	)
+	return sink
+}
+
+func (p *prometheusSink) SetNonces(validatorId int, ethereumNonce int, heimdallNonce int) {
+	label := strconv.Itoa(validatorId)
+	p.ethereumNonce.WithLabelValues(label).Set(float64(ethereumNonce))
+	p.heimdallNonce.WithLabelValues(label).Set(float64(heimdallNonce))
+}
+
+func (p *prometheusSink) SetNonceLag(validatorId int, lag int) {
+	p.nonceLag.WithLabelValues(strconv.Itoa(validatorId)).Set(float64(lag))
+}
+
+func (p *prometheusSink) IncSubmitted(validatorId int) {
+	p.submitted.WithLabelValues(strconv.Itoa(validatorId)).Inc()
+}
+
+func (p *prometheusSink) IncErrors(validatorId int) {
+	p.errors.WithLabelValues(strconv.Itoa(validatorId)).Inc()
+}
+
+func (p *prometheusSink) IncHeimdallcliFailures(validatorId int) {
+	p.heimdallcliFails.WithLabelValues(strconv.Itoa(validatorId)).Inc()
+}
+
+func (p *prometheusSink) IncSubgraphFailures(validatorId int) {
+	p.subgraphFails.WithLabelValues(strconv.Itoa(validatorId)).Inc()
+}
+
+func (p *prometheusSink) ObserveSubmitDuration(validatorId int, duration time.Duration) {
+	p.submitDuration.WithLabelValues(strconv.Itoa(validatorId)).Observe(duration.Seconds())
+}
+
+func (p *prometheusSink) IncReconcileMismatch(validatorId int) {
+	p.reconcileMismatch.WithLabelValues(strconv.Itoa(validatorId)).Inc()
+}
+
+func (p *prometheusSink) SetLastPollSuccess(validatorId int, at time.Time) {
+	p.lastPollSuccess.WithLabelValues(strconv.Itoa(validatorId)).Set(float64(at.Unix()))
+}
+
+func (p *prometheusSink) SetLastSubmit(validatorId int, at time.Time) {
+	p.lastSubmit.WithLabelValues(strconv.Itoa(validatorId)).Set(float64(at.Unix()))
+}
+
+func (p *prometheusSink) SetLastError(validatorId int, at time.Time) {
+	value := 0.0
+	if !at.IsZero() {
+		value = float64(at.Unix())
+	}
+	p.lastError.WithLabelValues(strconv.Itoa(validatorId)).Set(value)
+}
+
+func (p *prometheusSink) ObserveCatchUpDuration(validatorId int, duration time.Duration) {
+	p.catchUpDuration.WithLabelValues(strconv.Itoa(validatorId)).Observe(duration.Seconds())
+}
+
+func (p *prometheusSink) SetBelowMinPower(validatorId int, below bool) {
+	value := 0.0
+	if below {
+		value = 1
+	}
+	p.belowMinPower.WithLabelValues(strconv.Itoa(validatorId)).Set(value)
+}
+
+func (p *prometheusSink) IncPendingFinality(validatorId int) {
+	p.pendingFinality.WithLabelValues(strconv.Itoa(validatorId)).Inc()
+}
+
+func (p *prometheusSink) IncPanics(validatorId int) {
+	p.panics.WithLabelValues(strconv.Itoa(validatorId)).Inc()
+}
+
+func (p *prometheusSink) IncSubgraphMiss(validatorId int, cause string) {
+	p.subgraphMisses.WithLabelValues(strconv.Itoa(validatorId), cause).Inc()
+}
+
+func (p *prometheusSink) IncSubgraphThrottled() {
+	p.subgraphThrottled.Inc()
+}
+
+func (p *prometheusSink) IncEthReconnects() {
+	p.ethReconnects.Inc()
+}
+
+func (p *prometheusSink) SetPaused(paused bool) {
+	value := 0.0
+	if paused {
+		value = 1
+	}
+	p.paused.Set(value)
+}
+
+func (p *prometheusSink) SetBreakerState(profile string, state breakerState) {
+	p.breakerState.WithLabelValues(profile).Set(float64(state))
+}
+
+func (p *prometheusSink) SetSubgraphLag(blocks int64) {
+	p.subgraphLag.Set(float64(blocks))
+}
+
+func (p *prometheusSink) RemoveValidator(validatorId int) {
+	label := strconv.Itoa(validatorId)
+	p.ethereumNonce.DeleteLabelValues(label)
+	p.heimdallNonce.DeleteLabelValues(label)
+	p.nonceLag.DeleteLabelValues(label)
+	p.submitted.DeleteLabelValues(label)
+	p.errors.DeleteLabelValues(label)
+	p.heimdallcliFails.DeleteLabelValues(label)
+	p.subgraphFails.DeleteLabelValues(label)
+	p.submitDuration.DeleteLabelValues(label)
+	p.reconcileMismatch.DeleteLabelValues(label)
+	p.lastPollSuccess.DeleteLabelValues(label)
+	p.lastSubmit.DeleteLabelValues(label)
+	p.lastError.DeleteLabelValues(label)
+	p.pendingFinality.DeleteLabelValues(label)
+	p.panics.DeleteLabelValues(label)
+	p.subgraphMisses.DeleteLabelValues(label, watch.MissIndexingLag)
+	p.subgraphMisses.DeleteLabelValues(label, watch.MissAbsent)
+	p.catchUpDuration.DeleteLabelValues(label)
+	p.belowMinPower.DeleteLabelValues(label)
+}
+
+// httpMux is shared by every endpoint the process exposes.
+var httpMux = http.NewServeMux()
+
+// startMetricsServer serves /metrics on addr. It is a no-op when addr is empty.
+func startMetricsServer(addr string) {
+	if addr == "" {
+		return
+	}
+
+	httpMux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		slog.Info("Serving metrics", "addr", addr)
+		if err := http.ListenAndServe(addr, httpMux); err != nil {
+			slog.Error("Metrics server stopped", "err", err)
+		}
+	}()
+}
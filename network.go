@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// networkPreset holds the defaults selected by the `network` env var.
+type networkPreset struct {
+	// EthereumChainId is the chain the root contracts live on, which the
+	// Ethereum RPC is checked against.
+	EthereumChainId int64
+	// Env are the defaults of env vars not set explicitly.
+	Env map[string]string
+}
+
+var networks = map[string]networkPreset{
+	"mainnet": {
+		EthereumChainId: 1,
+		Env: map[string]string{
+			"polygon_sub_graph_url": "https://api.thegraph.com/subgraphs/name/maticnetwork/mainnet-root-subgraphs",
+			"heimdall_rest_url":     "https://heimdall-api.polygon.technology",
+			"heimdall_chain_id":     "heimdall-137",
+		},
+	},
+	"mumbai": {
+		EthereumChainId: 5,
+		Env: map[string]string{
+			"polygon_sub_graph_url": "https://api.thegraph.com/subgraphs/name/maticnetwork/mumbai-root-subgraphs",
+			"heimdall_rest_url":     "https://heimdall-api-testnet.polygon.technology",
+			"heimdall_chain_id":     "heimdall-80001",
+		},
+	},
+	// Amoy has no hosted root subgraph, so polygon_sub_graph_url must still
+	// be set.
+	"amoy": {
+		EthereumChainId: 11155111,
+		Env: map[string]string{
+			"heimdall_rest_url": "https://heimdall-api-amoy.polygon.technology",
+			"heimdall_chain_id": "heimdall-80002",
+		},
+	},
+}
+
+// Network is the preset selected with `network`, empty when none is.
+var Network string
+
+func networkNames() []string {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyNetwork sets the env defaults of the named preset. Variables already
+// set take precedence, except that heimdall_chain_id must match the preset,
+// since submitting to a different chain than the subgraph indexes is never
+// intended.
+func applyNetwork(name string) error {
+	preset, ok := networks[name]
+	if !ok {
+		return fmt.Errorf("invalid network %q, expected one of %s", name, strings.Join(networkNames(), ", "))
+	}
+
+	for key, value := range preset.Env {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+	if chainId := os.Getenv("heimdall_chain_id"); chainId != preset.Env["heimdall_chain_id"] {
+		return fmt.Errorf("heimdall_chain_id %q doesn't match network %s, expected %q", chainId, name, preset.Env["heimdall_chain_id"])
+	}
+
+	// A subgraph URL naming another network is almost certainly a mistake.
+	for _, url := range splitList(os.Getenv("polygon_sub_graph_url")) {
+		for other := range networks {
+			if other != name && strings.Contains(strings.ToLower(url), other) {
+				slog.Warn("polygon_sub_graph_url looks like it belongs to another network", "network", name, "url", url, "other_network", other)
+			}
+		}
+	}
+	return nil
+}
+
+// checkEthereumChain fails when the Ethereum RPC isn't on the chain of the
+// selected network.
+func checkEthereumChain(chainId int64) error {
+	if Network == "" {
+		return nil
+	}
+	if expected := networks[Network].EthereumChainId; chainId != expected {
+		return fmt.Errorf("ethereum_rpc_url is on chain %d, network %s expects chain %d", chainId, Network, expected)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"stake-update-go/clients"
+)
+
+// nonceBatcher fetches the Ethereum nonce of every watched validator in one
+// subgraph request and hands each worker its own value, instead of one
+// request per validator per cycle. The first worker to find the batch older
+// than maxAge refreshes it while the others wait for the result.
+type nonceBatcher struct {
+	mu        sync.Mutex
+	subgraph  clients.Subgraph
+	ids       []int
+	maxAge    time.Duration
+	nonces    map[int]int
+	fetchedAt time.Time
+}
+
+func newNonceBatcher(subgraph clients.Subgraph, validatorIds []int, maxAge time.Duration) *nonceBatcher {
+	return &nonceBatcher{subgraph: subgraph, ids: validatorIds, maxAge: maxAge}
+}
+
+// setupNonceBatches gives every profile a batch of the validators it serves,
+// since a batch is a single query to one subgraph. Called again, as when
+// -all finds the validator set changed, it updates the existing batches.
+func setupNonceBatches(validatorIds []int, maxAge time.Duration) {
+	ids := map[*profile][]int{}
+	for _, validatorId := range validatorIds {
+		p := validatorProfile(validatorId)
+		ids[p] = append(ids[p], validatorId)
+	}
+	for p, profileIds := range ids {
+		if p.nonceBatch == nil {
+			p.nonceBatch = newNonceBatcher(p.Subgraph, profileIds, maxAge)
+		} else {
+			p.nonceBatch.SetIds(profileIds)
+		}
+	}
+}
+
+// SetIds replaces the validators of the batch, refetching it on the next
+// Get.
+func (b *nonceBatcher) SetIds(validatorIds []int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ids = validatorIds
+	b.nonces = nil
+}
+
+// Get returns the latest nonce of validatorId, zero when it has none.
+func (b *nonceBatcher) Get(ctx context.Context, validatorId int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.nonces == nil || time.Since(b.fetchedAt) >= b.maxAge {
+		nonces, err := b.subgraph.LatestNonces(ctx, b.ids)
+		if err != nil {
+			return 0, err
+		}
+		b.nonces = nonces
+		b.fetchedAt = time.Now()
+	}
+	return b.nonces[validatorId], nil
+}
+
+// snapshot returns a copy of the batched nonces and when they were fetched.
+func (b *nonceBatcher) snapshot() (map[int]int, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	nonces := make(map[int]int, len(b.nonces))
+	for validatorId, nonce := range b.nonces {
+		nonces[validatorId] = nonce
+	}
+	return nonces, b.fetchedAt
+}
+
+// getEthereumValidatorNonce returns the latest nonce of validatorId, through
+// the batch when one is set up.
+func getEthereumValidatorNonce(ctx context.Context, validatorId int) (int, error) {
+	p := validatorProfile(validatorId)
+	if p.nonceBatch != nil {
+		return p.nonceBatch.Get(ctx, validatorId)
+	}
+	return p.Subgraph.LatestNonce(ctx, validatorId)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// pauser holds back submissions during maintenance while the loop keeps
+// polling, so nonces and lag stay current. It is paused by SIGUSR1 until
+// SIGUSR2, or while pause_file exists.
+type pauser struct {
+	mu     sync.Mutex
+	paused bool
+	// fileSeen is whether pause_file existed at the last check, to log
+	// changes once.
+	fileSeen bool
+}
+
+var pause = &pauser{}
+
+// Pause holds back submissions until Resume.
+func (p *pauser) Pause(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		slog.Info("Paused, stake-updates will not be submitted until resumed", "reason", reason)
+	}
+	p.paused = true
+	metrics.SetPaused(true)
+}
+
+func (p *pauser) Resume(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		slog.Info("Resumed submitting stake-updates", "reason", reason)
+	}
+	p.paused = false
+	metrics.SetPaused(p.fileSeen)
+}
+
+// Paused reports whether submissions are held back, by a signal or by
+// pause_file.
+func (p *pauser) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if PauseFile != "" {
+		_, err := os.Stat(PauseFile)
+		exists := err == nil
+		if exists != p.fileSeen {
+			if exists {
+				slog.Info("Pause file found, stake-updates will not be submitted until it is removed", "pause_file", PauseFile)
+			} else {
+				slog.Info("Pause file removed", "pause_file", PauseFile)
+			}
+			p.fileSeen = exists
+		}
+	}
+	paused := p.paused || p.fileSeen
+	metrics.SetPaused(paused)
+	return paused
+}
@@ -0,0 +1,5 @@
+package main
+
+// handlePauseSignals is a no-op, Windows has no SIGUSR1 and SIGUSR2. Use
+// pause_file instead.
+func handlePauseSignals() {}
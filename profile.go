@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"stake-update-go/clients"
+)
+
+// defaultProfileName names the profile made of the env configuration, used
+// by every validator the -config file doesn't assign to a profile.
+const defaultProfileName = "default"
+
+// profile holds the clients of one deployment of the subgraph, Heimdall and
+// Ethereum, so one process can serve validators of different networks, e.g.
+// a mainnet and a testnet fleet.
+type profile struct {
+	Name     string
+	Subgraph clients.Subgraph
+	Heimdall clients.Heimdall
+	Blocks   clients.Blocks
+	// Submitter is picked by submit_mode.
+	Submitter clients.Submitter
+	// breaker holds back the profile's submissions after repeated failures.
+	breaker *circuitBreaker
+
+	// nonceBatch is set up by runWatch when batch_nonce_queries is enabled.
+	nonceBatch *nonceBatcher
+	headTime   headTimeCache
+}
+
+// The external services, wired to the real clients by setupClients.
+var (
+	defaultProfile = newProfile(defaultProfileName)
+	// profiles are the profiles of the -config file by name.
+	profiles = map[string]*profile{}
+	runner   clients.Runner
+)
+
+func newProfile(name string) *profile {
+	return &profile{Name: name, breaker: newCircuitBreaker(name)}
+}
+
+// validatorProfile returns the clients the validator is served by.
+func validatorProfile(validatorId int) *profile {
+	if p, ok := profiles[validatorProfileName(validatorId)]; ok {
+		return p
+	}
+	return defaultProfile
+}
+
+// allProfiles returns the default profile followed by those of the -config
+// file ordered by name.
+func allProfiles() []*profile {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	all := []*profile{defaultProfile}
+	for _, name := range names {
+		all = append(all, profiles[name])
+	}
+	return all
+}
+
+// profileConfigOf returns the configuration p was set up from.
+func profileConfigOf(p *profile) profileConfig {
+	if config, ok := profileConfigs[p.Name]; ok {
+		return config
+	}
+	return envProfileConfig()
+}
+
+// setupProfileServices wires the subgraph, Heimdall and submission clients
+// of p, none of which connect before their first call.
+func setupProfileServices(p *profile, config profileConfig) {
+	p.Subgraph = newSubgraphClient(splitList(config.SubgraphURL))
+	p.Heimdall = newHeimdallClient(config.HeimdallRestURL)
+	p.Submitter = newSubmitter(config.HeimdallRestURL, config.HeimdallChainID)
+}
+
+// dialProfile connects p to its Ethereum RPC. Only the default profile is
+// checked against the network preset.
+func dialProfile(ctx context.Context, p *profile, config profileConfig) error {
+	blocksClient, err := dialEthBlocks(ctx, config.EthereumRPCURL)
+	if err != nil {
+		if p != defaultProfile {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		return err
+	}
+	if p == defaultProfile && Network != "" {
+		chainId, err := blocksClient.ChainID(ctx)
+		if err != nil {
+			return err
+		}
+		if err = checkEthereumChain(chainId); err != nil {
+			return err
+		}
+	}
+	p.Blocks = blocksClient
+	if BlockCacheSize > 0 {
+		p.Blocks = clients.NewCachedBlocks(blocksClient, BlockCacheSize)
+	}
+	return nil
+}
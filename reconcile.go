@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runReconciler periodically checks that every submission recorded in the
+// state file is reflected by the validator nonce on Heimdall. Submissions
+// younger than one interval are left alone to give the tx time to land.
+func runReconciler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reconcileSubmissions(ctx, time.Now().Add(-interval))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func reconcileSubmissions(ctx context.Context, submittedBefore time.Time) {
+	for _, update := range stateStore.Entries() {
+		if update.SubmittedAt.After(submittedBefore) {
+			continue
+		}
+
+		heimdallNonce, err := getHeimdallValidatorNonce(ctx, update.ValidatorID)
+		if err != nil {
+			validatorLogger(update.ValidatorID).Error("Reconcile: error getting heimdall nonce", "err", err)
+			continue
+		}
+
+		if heimdallNonce < update.Nonce {
+			validatorLogger(update.ValidatorID).Warn("Reconcile mismatch", "nonce", update.Nonce, "heimdall_nonce", heimdallNonce, "tx_hash", update.TxHash)
+			metrics.IncReconcileMismatch(update.ValidatorID)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// recordedCommand is a line of the -record-commands file.
+type recordedCommand struct {
+	ValidatorID int      `json:"validator_id"`
+	Nonce       int      `json:"nonce"`
+	Command     string   `json:"command"`
+	Args        []string `json:"args"`
+}
+
+// commandRecorder writes every heimdallcli command about to be run, or that
+// would be with -dry-run, as JSON lines, so they can be diffed against a
+// golden file. Lines carry no timestamps and are identical across runs.
+type commandRecorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// commandLog is nil unless -record-commands is given.
+var commandLog *commandRecorder
+
+func openCommandRecorder(path string) (*commandRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &commandRecorder{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (r *commandRecorder) Record(validatorId int, nonce int, args []string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.encoder.Encode(recordedCommand{ValidatorID: validatorId, Nonce: nonce, Command: "heimdallcli", Args: args})
+}
+
+func (r *commandRecorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"stake-update-go/clients"
+)
+
+// checkTimeout bounds every probe of -check.
+const checkTimeout = 15 * time.Second
+
+// defaultCheckValidator is looked up on Heimdall when no validator is
+// configured. Validator 1 exists on every public network.
+const defaultCheckValidator = 1
+
+// selfCheck is a probe of -check, returning what it found when it passes.
+type selfCheck struct {
+	name  string
+	probe func(ctx context.Context) (string, error)
+}
+
+// runSelfCheck probes every external dependency once, printing a PASS or
+// FAIL line for each, and fails when any probe did.
+func runSelfCheck(ctx context.Context) error {
+	setupServiceClients()
+	validatorId := defaultCheckValidator
+	if ids := append(append([]int{}, ConfigValidators...), Validators...); len(ids) > 0 {
+		validatorId = ids[0]
+	}
+
+	checks := []selfCheck{
+		{"ethereum", checkEthereum},
+		{"subgraph", func(ctx context.Context) (string, error) {
+			block, err := defaultProfile.Subgraph.IndexedBlock(ctx)
+			return fmt.Sprintf("indexed up to block %d", block), err
+		}},
+		{"heimdall", func(ctx context.Context) (string, error) {
+			validator, err := defaultProfile.Heimdall.Validator(ctx, validatorId)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("validator %d at nonce %d", validatorId, validator.Result.Nonce), nil
+		}},
+		{"heimdallcli", checkHeimdallcli},
+	}
+
+	failed := 0
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		detail, err := check.probe(checkCtx)
+		cancel()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %-12s %v\n", check.name, err)
+			continue
+		}
+		fmt.Printf("PASS %-12s %s\n", check.name, detail)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// checkEthereum dials the Ethereum RPC once, without the startup retries,
+// and reads the head block.
+func checkEthereum(ctx context.Context) (string, error) {
+	blocksClient, err := clients.DialEthBlocks(ctx, EthereumRPCUrl, clients.NewHTTPClient(0, HTTPTransport))
+	if err != nil {
+		return "", err
+	}
+	head, err := blocksClient.Head(ctx, "latest")
+	if err != nil {
+		return "", err
+	}
+	if Network != "" {
+		chainId, err := blocksClient.ChainID(ctx)
+		if err != nil {
+			return "", err
+		}
+		if err = checkEthereumChain(chainId); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("head block %d", head), nil
+}
+
+// checkHeimdallcli runs `heimdallcli version`, which only submit_mode exec
+// needs.
+func checkHeimdallcli(ctx context.Context) (string, error) {
+	if SubmitMode == "rpc" {
+		return "not used with submit_mode rpc", nil
+	}
+	output, err := runner.Run("heimdallcli", "version")
+	version := strings.TrimSpace(string(output))
+	if err != nil {
+		if version != "" {
+			err = fmt.Errorf("%v: %s", err, version)
+		}
+		return "", fmt.Errorf("heimdallcli version failed: %v", err)
+	}
+	if version == "" {
+		return "", errors.New("heimdallcli version printed nothing")
+	}
+	return "version " + strings.SplitN(version, "\n", 2)[0], nil
+}
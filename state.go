@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// submissionState is the on-disk record of submitted updates, keyed by
+// validator id. Only the latest submission per validator is kept: nonces are
+// sequential, so if the latest one landed on Heimdall every earlier one did too.
+type submissionState struct {
+	mu        sync.Mutex
+	path      string
+	Submitted map[string]SubmittedUpdate `json:"submitted"`
+}
+
+var stateStore = &submissionState{Submitted: map[string]SubmittedUpdate{}}
+
+func loadState(path string) (*submissionState, error) {
+	state := &submissionState{path: path, Submitted: map[string]SubmittedUpdate{}}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	if state.Submitted == nil {
+		state.Submitted = map[string]SubmittedUpdate{}
+	}
+	return state, nil
+}
+
+// Record stores a successful submission and writes the state file if one is
+// configured.
+func (s *submissionState) Record(update SubmittedUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Submitted[strconv.Itoa(update.ValidatorID)] = update
+	return s.save()
+}
+
+// Last returns the latest submission recorded for the validator.
+func (s *submissionState) Last(validatorId int) (SubmittedUpdate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update, ok := s.Submitted[strconv.Itoa(validatorId)]
+	return update, ok
+}
+
+// Entries returns a copy of the recorded submissions.
+func (s *submissionState) Entries() []SubmittedUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]SubmittedUpdate, 0, len(s.Submitted))
+	for _, update := range s.Submitted {
+		entries = append(entries, update)
+	}
+	return entries
+}
+
+// save writes the state to a temporary file next to path and renames it into
+// place, so a crash mid-write never leaves a truncated state file behind.
+func (s *submissionState) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
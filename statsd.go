@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// statsdSink emits DogStatsD formatted metrics over UDP. Sends are
+// fire-and-forget, a missing agent never blocks the loop.
+type statsdSink struct {
+	conn net.Conn
+}
+
+func newStatsdSink(addr string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statsd_addr %s: %v", addr, err)
+	}
+	return &statsdSink{conn: conn}, nil
+}
+
+func (s *statsdSink) send(name string, value string, kind string, validatorId int) {
+	fmt.Fprintf(s.conn, "%s:%s|%s|#validator_id:%d", name, value, kind, validatorId)
+}
+
+// sendUntagged emits a metric that isn't about a single validator.
+func (s *statsdSink) sendUntagged(name string, value string, kind string) {
+	fmt.Fprintf(s.conn, "%s:%s|%s", name, value, kind)
+}
+
+func (s *statsdSink) SetNonces(validatorId int, ethereumNonce int, heimdallNonce int) {
+	s.send("stake_update.ethereum_nonce", fmt.Sprint(ethereumNonce), "g", validatorId)
+	s.send("stake_update.heimdall_nonce", fmt.Sprint(heimdallNonce), "g", validatorId)
+}
+
+func (s *statsdSink) SetNonceLag(validatorId int, lag int) {
+	s.send("stake_update.nonce_lag", fmt.Sprint(lag), "g", validatorId)
+}
+
+func (s *statsdSink) IncSubmitted(validatorId int) {
+	s.send("stake_update.submitted", "1", "c", validatorId)
+}
+
+func (s *statsdSink) IncErrors(validatorId int) {
+	s.send("stake_update.errors", "1", "c", validatorId)
+}
+
+func (s *statsdSink) IncHeimdallcliFailures(validatorId int) {
+	s.send("stake_update.heimdallcli_failures", "1", "c", validatorId)
+}
+
+func (s *statsdSink) IncSubgraphFailures(validatorId int) {
+	s.send("stake_update.subgraph_failures", "1", "c", validatorId)
+}
+
+func (s *statsdSink) ObserveSubmitDuration(validatorId int, duration time.Duration) {
+	s.send("stake_update.submit_duration", fmt.Sprint(duration.Milliseconds()), "ms", validatorId)
+}
+
+func (s *statsdSink) IncReconcileMismatch(validatorId int) {
+	s.send("stake_update.reconcile_mismatch", "1", "c", validatorId)
+}
+
+func (s *statsdSink) SetLastPollSuccess(validatorId int, at time.Time) {
+	s.send("stake_update.last_poll_success_timestamp", fmt.Sprint(at.Unix()), "g", validatorId)
+}
+
+func (s *statsdSink) SetLastSubmit(validatorId int, at time.Time) {
+	s.send("stake_update.last_submit_timestamp", fmt.Sprint(at.Unix()), "g", validatorId)
+}
+
+func (s *statsdSink) SetLastError(validatorId int, at time.Time) {
+	value := int64(0)
+	if !at.IsZero() {
+		value = at.Unix()
+	}
+	s.send("stake_update.last_error_timestamp", fmt.Sprint(value), "g", validatorId)
+}
+
+func (s *statsdSink) ObserveCatchUpDuration(validatorId int, duration time.Duration) {
+	s.send("stake_update.catch_up_duration", fmt.Sprint(duration.Milliseconds()), "ms", validatorId)
+}
+
+func (s *statsdSink) SetBelowMinPower(validatorId int, below bool) {
+	value := "0"
+	if below {
+		value = "1"
+	}
+	s.send("stake_update.below_min_power", value, "g", validatorId)
+}
+
+func (s *statsdSink) IncPendingFinality(validatorId int) {
+	s.send("stake_update.pending_finality", "1", "c", validatorId)
+}
+
+func (s *statsdSink) IncPanics(validatorId int) {
+	s.send("stake_update.worker_panics", "1", "c", validatorId)
+}
+
+func (s *statsdSink) IncSubgraphMiss(validatorId int, cause string) {
+	s.send("stake_update.subgraph_misses."+cause, "1", "c", validatorId)
+}
+
+func (s *statsdSink) IncSubgraphThrottled() {
+	s.sendUntagged("stake_update.subgraph_throttled", "1", "c")
+}
+
+func (s *statsdSink) IncEthReconnects() {
+	s.sendUntagged("stake_update.eth_reconnects", "1", "c")
+}
+
+func (s *statsdSink) SetPaused(paused bool) {
+	value := "0"
+	if paused {
+		value = "1"
+	}
+	s.sendUntagged("stake_update.paused", value, "g")
+}
+
+func (s *statsdSink) SetBreakerState(profile string, state breakerState) {
+	fmt.Fprintf(s.conn, "stake_update.heimdallcli_breaker_state:%d|g|#profile:%s", int(state), profile)
+}
+
+func (s *statsdSink) SetSubgraphLag(blocks int64) {
+	s.sendUntagged("stake_update.subgraph_lag_blocks", fmt.Sprint(blocks), "g")
+}
+
+// RemoveValidator is a no-op, StatsD keeps no per-series state client side.
+func (s *statsdSink) RemoveValidator(validatorId int) {}
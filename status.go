@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"stake-update-go/clients"
+)
+
+// validatorStatus is the in-memory view of one watched validator.
+type validatorStatus struct {
+	ValidatorID   int       `json:"validatorId"`
+	EthereumNonce int       `json:"ethereumNonce"`
+	HeimdallNonce int       `json:"heimdallNonce"`
+	Submitted     int       `json:"submitted"`
+	Errors        int       `json:"errors"`
+	LastSubmit    time.Time `json:"lastSubmit"`
+
+	LastSuccess time.Time `json:"lastSuccess"`
+	// LastError and LastErrorAt are the error of the last failed cycle,
+	// cleared by the next successful one.
+	LastError           string        `json:"lastError,omitempty"`
+	LastErrorAt         time.Time     `json:"lastErrorAt"`
+	ConsecutiveFailures int           `json:"consecutiveFailures"`
+	BackoffDelay        time.Duration `json:"backoffDelay"`
+}
+
+// statusBoard holds the status of every watched validator.
+type statusBoard struct {
+	mu         sync.Mutex
+	validators map[int]*validatorStatus
+}
+
+var board = &statusBoard{validators: map[int]*validatorStatus{}}
+
+// update runs fn on the status of validatorId under the board lock.
+func (b *statusBoard) update(validatorId int, fn func(status *validatorStatus)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status, ok := b.validators[validatorId]
+	if !ok {
+		status = &validatorStatus{ValidatorID: validatorId}
+		b.validators[validatorId] = status
+	}
+	fn(status)
+}
+
+func (b *statusBoard) SetNonces(validatorId int, ethereumNonce int, heimdallNonce int) {
+	b.update(validatorId, func(status *validatorStatus) {
+		status.EthereumNonce = ethereumNonce
+		status.HeimdallNonce = heimdallNonce
+	})
+}
+
+func (b *statusBoard) RecordSubmit(validatorId int, at time.Time) {
+	b.update(validatorId, func(status *validatorStatus) {
+		status.Submitted++
+		status.LastSubmit = at
+	})
+}
+
+// RecordError records a failed cycle and the backoff delay before the retry.
+func (b *statusBoard) RecordError(validatorId int, err error, backoffDelay time.Duration) {
+	now := time.Now()
+	b.update(validatorId, func(status *validatorStatus) {
+		status.Errors++
+		status.LastError = err.Error()
+		status.LastErrorAt = now
+		status.ConsecutiveFailures++
+		status.BackoffDelay = backoffDelay
+	})
+	metrics.SetLastError(validatorId, now)
+}
+
+// RecordSuccess records a cycle that completed without error, clearing the
+// last error.
+func (b *statusBoard) RecordSuccess(validatorId int, backoffDelay time.Duration) {
+	b.update(validatorId, func(status *validatorStatus) {
+		status.LastSuccess = time.Now()
+		status.LastError = ""
+		status.LastErrorAt = time.Time{}
+		status.ConsecutiveFailures = 0
+		status.BackoffDelay = backoffDelay
+	})
+	metrics.SetLastError(validatorId, time.Time{})
+}
+
+// LastSubmit returns when the validator last had a successful submission.
+func (b *statusBoard) LastSubmit(validatorId int) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if status, ok := b.validators[validatorId]; ok {
+		return status.LastSubmit
+	}
+	return time.Time{}
+}
+
+// Remove drops a validator that is no longer watched.
+func (b *statusBoard) Remove(validatorId int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.validators, validatorId)
+}
+
+// Snapshot returns a copy of every validator status ordered by validator id.
+func (b *statusBoard) Snapshot() []validatorStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]validatorStatus, 0, len(b.validators))
+	for _, status := range b.validators {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ValidatorID < statuses[j].ValidatorID })
+	return statuses
+}
+
+func init() {
+	httpMux.HandleFunc("/status", handleStatus)
+}
+
+// statusResponse is the body of GET /status.
+type statusResponse struct {
+	Paused     bool              `json:"paused"`
+	Breakers   map[string]string `json:"breakers"`
+	Validators []validatorStatus `json:"validators"`
+}
+
+// errorUrl matches URLs within error messages, which may carry API keys.
+var errorUrl = regexp.MustCompile(`https?://[^\s"']+`)
+
+// handleStatus serves the board as JSON, with URLs in the errors redacted
+// since, unlike /debug/state, it needs no token.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	statuses := board.Snapshot()
+	for i := range statuses {
+		statuses[i].LastError = errorUrl.ReplaceAllStringFunc(statuses[i].LastError, clients.RedactURL)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(statusResponse{Paused: pause.Paused(), Breakers: breakerStates(), Validators: statuses})
+}
+
+// Summary renders the board as a single line, e.g.
+// `12 validators | 2 behind | 148 submitted | 0 errors | last submit 3m ago`.
+func (b *statusBoard) Summary(now time.Time) string {
+	var behind, submitted, errors int
+	var lastSubmit time.Time
+	statuses := b.Snapshot()
+	for _, status := range statuses {
+		if status.EthereumNonce > status.HeimdallNonce {
+			behind++
+		}
+		submitted += status.Submitted
+		errors += status.Errors
+		if status.LastSubmit.After(lastSubmit) {
+			lastSubmit = status.LastSubmit
+		}
+	}
+
+	last := "never"
+	if !lastSubmit.IsZero() {
+		last = formatAge(now.Sub(lastSubmit)) + " ago"
+	}
+	return fmt.Sprintf("%d validators | %d behind | %d submitted | %d errors | last submit %s", len(statuses), behind, submitted, errors, last)
+}
+
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	default:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+}
+
+// runStatusSummary prints the board summary every interval, refreshing a
+// single line in place when stdout is a terminal and logging it otherwise.
+func runStatusSummary(interval time.Duration) {
+	tty := isTerminal(os.Stdout)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		summary := board.Summary(time.Now())
+		if tty {
+			fmt.Printf("\r\033[K%s", summary)
+		} else {
+			slog.Info("Status", "summary", summary)
+		}
+	}
+}
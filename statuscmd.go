@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func init() {
+	registerMode(&mode{
+		Name:        "status",
+		Args:        "[-json] <validator_id>[,<validator_id>...]",
+		Description: "Print the Ethereum and Heimdall nonces of each validator once, without submitting",
+		Run:         runStatus,
+	})
+}
+
+// validatorLag is one row of the status output.
+type validatorLag struct {
+	ValidatorID   int    `json:"validator_id"`
+	EthereumNonce int    `json:"ethereum_nonce"`
+	HeimdallNonce int    `json:"heimdall_nonce"`
+	Lag           int    `json:"lag"`
+	Error         string `json:"error,omitempty"`
+}
+
+func runStatus(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "Print JSON instead of a table")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	validatorIds := append(append([]int{}, ConfigValidators...), Validators...)
+	for _, arg := range flags.Args() {
+		ids, err := parseValidatorIds(arg)
+		if err != nil {
+			return err
+		}
+		validatorIds = append(validatorIds, ids...)
+	}
+	validatorIds = uniqueValidatorIds(validatorIds)
+	if len(validatorIds) == 0 {
+		return fmt.Errorf("no validator ids given")
+	}
+
+	if err := setupClients(ctx); err != nil {
+		return err
+	}
+
+	rows := make([]validatorLag, 0, len(validatorIds))
+	failed := 0
+	for _, validatorId := range validatorIds {
+		row := queryValidatorLag(ctx, validatorId)
+		if row.Error != "" {
+			failed++
+		}
+		rows = append(rows, row)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(rows); err != nil {
+			return err
+		}
+	} else {
+		printValidatorLags(rows)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to query %d of %d validators", failed, len(rows))
+	}
+	return nil
+}
+
+func queryValidatorLag(ctx context.Context, validatorId int) validatorLag {
+	row := validatorLag{ValidatorID: validatorId}
+	ethNonce, err := getEthereumValidatorNonce(ctx, validatorId)
+	if err != nil {
+		row.Error = fmt.Sprintf("ethereum nonce: %v", err)
+		return row
+	}
+	heimdallNonce, err := getHeimdallValidatorNonce(ctx, validatorId)
+	if err != nil {
+		row.Error = fmt.Sprintf("heimdall nonce: %v", err)
+		return row
+	}
+	row.EthereumNonce = ethNonce
+	row.HeimdallNonce = heimdallNonce
+	row.Lag = ethNonce - heimdallNonce
+	return row
+}
+
+func printValidatorLags(rows []validatorLag) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VALIDATOR\tETH NONCE\tHEIMDALL NONCE\tLAG")
+	for _, row := range rows {
+		if row.Error != "" {
+			fmt.Fprintf(w, "%d\t-\t-\t-\t%s\n", row.ValidatorID, row.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\n", row.ValidatorID, row.EthereumNonce, row.HeimdallNonce, row.Lag)
+	}
+	w.Flush()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// runSubgraphLagMonitor periodically compares the block the subgraph has
+// indexed with the Ethereum head. A lagging subgraph is the usual reason
+// catch-up stalls with "not indexed yet".
+func runSubgraphLagMonitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkSubgraphLag(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func checkSubgraphLag(ctx context.Context) {
+	for _, p := range allProfiles() {
+		checkProfileSubgraphLag(ctx, p)
+	}
+}
+
+// checkProfileSubgraphLag checks the subgraph of p. Only the lag of the
+// default profile is exported as a metric.
+func checkProfileSubgraphLag(ctx context.Context, p *profile) {
+	logger := slog.Default()
+	if p != defaultProfile {
+		logger = logger.With("profile", p.Name)
+	}
+	indexed, err := p.Subgraph.IndexedBlock(ctx)
+	if err != nil {
+		logger.Warn("Unable to get the subgraph indexed block", "err", err)
+		return
+	}
+	head, err := p.Blocks.Head(ctx, "latest")
+	if err != nil {
+		logger.Warn("Unable to get the latest Ethereum block", "err", err)
+		return
+	}
+
+	lag := int64(head) - int64(indexed)
+	if p == defaultProfile {
+		metrics.SetSubgraphLag(lag)
+	}
+	if lag > int64(SubgraphMaxLag) {
+		logger.Warn("Subgraph is indexing behind the chain head", "indexed_block", indexed, "head", head, "lag_blocks", lag, "max_lag_blocks", SubgraphMaxLag)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SubmissionGroups maps validator ids to a submission group key, typically
+// the Heimdall signer address. Validators without an entry form a group of
+// their own.
+var SubmissionGroups = map[int]string{}
+
+// parseSubmissionGroups parses `submission_groups`, a comma separated list of
+// validator_id=group pairs, e.g. `4=0xabc,12=0xabc`.
+func parseSubmissionGroups(value string) (map[int]string, error) {
+	groups := map[int]string{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid submission group %q, expected validator_id=group", entry)
+		}
+		validatorId, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid validator id in submission group %q", entry)
+		}
+		groups[validatorId] = strings.ToLower(strings.TrimSpace(parts[1]))
+	}
+	return groups, nil
+}
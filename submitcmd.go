@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"stake-update-go/watch"
+)
+
+func init() {
+	registerMode(&mode{
+		Name:        "submit",
+		Args:        "[-force] -validator <validator_id> -nonce <nonce>",
+		Description: "Submit the stake-update with the given nonce once and exit, -force skips the min_block_age check",
+		Run:         runSubmit,
+	})
+}
+
+func runSubmit(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("submit", flag.ContinueOnError)
+	validatorId := flags.Int("validator", -1, "Validator id of the stake-update")
+	nonce := flags.Int("nonce", -1, "Nonce of the stake-update")
+	flags.BoolVar(&ForceSubmit, "force", false, "Submit even when the block is younger than min_block_age_seconds")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *validatorId < 0 {
+		return errors.New("-validator is required")
+	}
+	if *nonce < 0 {
+		return errors.New("-nonce is required")
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+
+	var err error
+	stateStore, err = loadState(StateFile)
+	if err != nil {
+		return err
+	}
+	if err = setupClients(ctx); err != nil {
+		return err
+	}
+
+	logger := validatorLogger(*validatorId).With("nonce", *nonce)
+	if ForceSubmit {
+		logger.Warn("Forced submission, min_block_age is not enforced")
+	}
+	result, err := newWatcher().Process(ctx, *validatorId, *nonce)
+	if err != nil {
+		return err
+	}
+	switch result.Outcome {
+	case watch.ResultSubmitted:
+		return nil
+	case watch.ResultPendingFinality:
+		return errors.New("the stake-update's block isn't final yet, pass -force to skip min_block_age")
+	default:
+		return fmt.Errorf("stake-update not submitted: %s", result.Outcome)
+	}
+}
@@ -0,0 +1,96 @@
+package watch
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff produces exponentially growing retry delays with jitter. It drops
+// back to Base only after ResetSuccesses consecutive successes, so an
+// intermittent outage doesn't flap between short and long delays.
+type Backoff struct {
+	Base           time.Duration
+	Max            time.Duration
+	ResetSuccesses int
+
+	current   time.Duration
+	successes int
+}
+
+// newBackoff returns a backoff with the settings of Config.Backoff.
+func (w *Watcher) newBackoff() *Backoff {
+	return &Backoff{
+		Base:           w.Config.Backoff.Base,
+		Max:            w.Config.Backoff.Max,
+		ResetSuccesses: w.Config.Backoff.ResetSuccesses,
+	}
+}
+
+// Next returns the delay to wait before retrying after a failure.
+func (b *Backoff) Next() time.Duration {
+	b.successes = 0
+	if b.current == 0 {
+		b.current = b.Base
+	} else {
+		b.current *= 2
+	}
+	if b.current > b.Max {
+		b.current = b.Max
+	}
+	return jitter(b.current)
+}
+
+// Current returns the delay the backoff has grown to, zero when reset.
+func (b *Backoff) Current() time.Duration {
+	return b.current
+}
+
+// Success records a successful cycle.
+func (b *Backoff) Success() {
+	if b.current == 0 {
+		return
+	}
+	b.successes++
+	if b.successes >= b.ResetSuccesses {
+		b.current = 0
+		b.successes = 0
+	}
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random duration between half of d and d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return d/2 + time.Duration(jitterRand.Int63n(int64(d/2)))
+}
+
+// RandomDuration returns a random duration in [0, d).
+func RandomDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(d)))
+}
+
+// pollDelay returns the validator's poll interval, varied by up to
+// PollJitterPercent either way so validators that started together drift
+// apart instead of polling in lockstep.
+func (w *Watcher) pollDelay(validatorId int) time.Duration {
+	interval := w.Config.PollInterval(validatorId)
+	if w.Config.PollJitterPercent == 0 {
+		return interval
+	}
+	spread := interval * time.Duration(w.Config.PollJitterPercent) / 100
+	return interval - spread + RandomDuration(2*spread)
+}
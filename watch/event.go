@@ -0,0 +1,230 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"stake-update-go/clients"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Event is a staking event that takes a validator nonce: a StakeUpdateEvent,
+// SignerChangeEvent or ValidatorExitEvent, each relayed to Heimdall with its
+// own message.
+type Event interface {
+	// Kind names the Heimdall message, e.g. signer-update.
+	Kind() string
+	BlockNumber() string
+	TxHash() string
+	Submit(ctx context.Context, submitter clients.Submitter) error
+	// LogAttrs describe the event in the submission logs.
+	LogAttrs() []any
+}
+
+// eventError is returned by getStakeUpdate when the nonce has no
+// stake-update because it belongs to another event, which Heimdall counts as
+// well. Process dispatches the event instead.
+type eventError struct {
+	ValidatorID int
+	Nonce       int
+	Event       Event
+}
+
+func (e *eventError) Error() string {
+	return fmt.Sprintf("nonce %d of validator %d is a %s, not a stake-update", e.Nonce, e.ValidatorID, e.Event.Kind())
+}
+
+// lookupEvent looks for another event with the nonce the subgraph has no
+// stake-update for.
+func (w *Watcher) lookupEvent(ctx context.Context, logger *slog.Logger, validatorId int, nonce int) (Event, bool) {
+	if change, ok := w.lookupSignerChange(ctx, logger, validatorId, nonce); ok {
+		return SignerChangeEvent{change}, true
+	}
+	if exit, ok := w.lookupValidatorExit(ctx, logger, validatorId, nonce); ok {
+		return ValidatorExitEvent{exit}, true
+	}
+	return nil, false
+}
+
+// processEvent submits an event other than a stake-update for nonce, once
+// its block is checked like getVerifiedStakeUpdate does. There is no
+// verify_stake_event check for them.
+func (w *Watcher) processEvent(ctx context.Context, logger *slog.Logger, result Result, validatorId int, nonce int, event Event) (Result, error) {
+	kind := event.Kind()
+	logger = logger.With("kind", kind)
+	result.TxHash = event.TxHash()
+	logger.Info("Nonce is not a stake-update, dispatching a " + kind)
+
+	block, err := w.Clients(validatorId).Blocks.Block(ctx, event.BlockNumber())
+	if err != nil {
+		logger.Error("Unable to get block", "block", event.BlockNumber(), "err", err)
+		return result.with(ResultFailed), err
+	}
+	if !blockContainsTx(block, event.TxHash()) {
+		logger.Warn("Block conflict", "block", event.BlockNumber(), "tx_hash", event.TxHash(), "block_hash", block.Hash().Hex())
+		return result.with(ResultFailed), errBlockConflict
+	}
+	return w.submitEvent(ctx, logger, result, validatorId, nonce, event, block)
+}
+
+// submitEvent is the submission pipeline shared by every kind of event: the
+// finality checks, the interactive confirmation, pause and circuit breaker,
+// then the submission itself, its audit line and bookkeeping.
+func (w *Watcher) submitEvent(ctx context.Context, logger *slog.Logger, result Result, validatorId int, nonce int, event Event, block *types.Block) (Result, error) {
+	kind := event.Kind()
+	result, ok, err := w.checkBlockFinality(ctx, logger, validatorId, block, result)
+	if !ok {
+		return result, err
+	}
+
+	if w.Confirm != nil && !w.Confirm(ctx, event) {
+		logger.Info("Submission not confirmed, skipping", "kind", kind)
+		return result.with(ResultDeferred), nil
+	}
+
+	logger = logger.With("block", event.BlockNumber(), "tx_hash", event.TxHash()).With(event.LogAttrs()...)
+	if w.Pause.Paused() {
+		logger.Info("Paused, not submitting " + kind)
+		return result.with(ResultDeferred), nil
+	}
+	c := w.Clients(validatorId)
+	if !w.Config.DryRun && !c.Breaker.Allow() {
+		logger.Info("Circuit breaker open, not submitting " + kind)
+		return result.with(ResultDeferred), nil
+	}
+	if w.Config.SubmitMode == "exec" {
+		args := w.Args(event)
+		logger.Info("Submitting "+kind, "command", "heimdallcli "+strings.Join(args, " "))
+		if err = w.Commands.Record(validatorId, nonce, args); err != nil {
+			logger.Error("Unable to record the command", "err", err)
+		}
+	} else {
+		logger.Info("Submitting "+kind, "submit_mode", w.Config.SubmitMode)
+	}
+	if w.Config.DryRun {
+		logger.Info("Dry run, not submitting")
+		w.Audit(validatorId, nonce, event, true, nil)
+		return result.with(ResultSubmitted), nil
+	}
+
+	submitStart := w.now()
+	err = event.Submit(ctx, c.Submitter)
+	c.Breaker.Record(ctx, err)
+	w.Audit(validatorId, nonce, event, false, err)
+	if err != nil {
+		logger.Error("Error submitting "+kind, "submit_mode", w.Config.SubmitMode, "err", err)
+		w.Metrics.IncHeimdallcliFailures(validatorId)
+		return result.with(ResultFailed), err
+	}
+	w.recordSubmission(logger, validatorId, nonce, event.TxHash(), submitStart)
+	logger.Info("Submitted " + kind)
+
+	if w.Config.ConfirmTimeout > 0 {
+		if err = w.waitForHeimdallNonce(ctx, logger, validatorId, nonce); err != nil {
+			return result.with(ResultFailed), err
+		}
+	}
+	return result.with(ResultSubmitted), nil
+}
+
+// StakeUpdateEvent relays a stake-update.
+type StakeUpdateEvent struct {
+	clients.StakeUpdate
+}
+
+func (e StakeUpdateEvent) Kind() string        { return "stake-update" }
+func (e StakeUpdateEvent) BlockNumber() string { return e.Block }
+func (e StakeUpdateEvent) TxHash() string      { return e.TransactionHash }
+
+func (e StakeUpdateEvent) Submit(ctx context.Context, submitter clients.Submitter) error {
+	return submitter.SubmitStakeUpdate(ctx, e.StakeUpdate)
+}
+
+func (e StakeUpdateEvent) LogAttrs() []any {
+	return []any{"staked_amount", e.TotalStaked}
+}
+
+// lookupSignerChange looks for a signer change with the nonce the subgraph
+// has no stake-update for. When the subgraph fails to answer the nonce is
+// just left as not indexed.
+func (w *Watcher) lookupSignerChange(ctx context.Context, logger *slog.Logger, validatorId int, nonce int) (clients.SignerChange, bool) {
+	change, err := w.Clients(validatorId).Subgraph.SignerChange(ctx, validatorId, nonce)
+	if err == errSignerChangeNotFound {
+		return clients.SignerChange{}, false
+	}
+	if err != nil {
+		logger.Debug("Unable to look up a signer change for the nonce", "err", err)
+		return clients.SignerChange{}, false
+	}
+	if change.ValidatorID != strconv.Itoa(validatorId) || change.Nonce != strconv.Itoa(nonce) {
+		logger.Error("Subgraph returned another signer change than requested", "id", change.ID, "validator", change.ValidatorID, "signer_change_nonce", change.Nonce)
+		w.Metrics.IncSubgraphFailures(validatorId)
+		return clients.SignerChange{}, false
+	}
+	return change, true
+}
+
+// errSignerChangeNotFound is returned when the subgraph has no signer change
+// for the nonce either.
+var errSignerChangeNotFound = clients.ErrSignerChangeNotFound
+
+// SignerChangeEvent relays a signer change with a signer-update.
+type SignerChangeEvent struct {
+	clients.SignerChange
+}
+
+func (e SignerChangeEvent) Kind() string        { return "signer-update" }
+func (e SignerChangeEvent) BlockNumber() string { return e.Block }
+func (e SignerChangeEvent) TxHash() string      { return e.TransactionHash }
+
+func (e SignerChangeEvent) Submit(ctx context.Context, submitter clients.Submitter) error {
+	return submitter.SubmitSignerUpdate(ctx, e.SignerChange)
+}
+
+func (e SignerChangeEvent) LogAttrs() []any {
+	return []any{"new_signer", e.NewSigner}
+}
+
+// lookupValidatorExit looks for an unstake initiation with the nonce the
+// subgraph has no stake-update for, like lookupSignerChange.
+func (w *Watcher) lookupValidatorExit(ctx context.Context, logger *slog.Logger, validatorId int, nonce int) (clients.ValidatorExit, bool) {
+	exit, err := w.Clients(validatorId).Subgraph.ValidatorExit(ctx, validatorId, nonce)
+	if err == errValidatorExitNotFound {
+		return clients.ValidatorExit{}, false
+	}
+	if err != nil {
+		logger.Debug("Unable to look up a validator exit for the nonce", "err", err)
+		return clients.ValidatorExit{}, false
+	}
+	if exit.ValidatorID != strconv.Itoa(validatorId) || exit.Nonce != strconv.Itoa(nonce) {
+		logger.Error("Subgraph returned another validator exit than requested", "id", exit.ID, "validator", exit.ValidatorID, "validator_exit_nonce", exit.Nonce)
+		w.Metrics.IncSubgraphFailures(validatorId)
+		return clients.ValidatorExit{}, false
+	}
+	return exit, true
+}
+
+// errValidatorExitNotFound is returned when the subgraph has no unstake
+// initiation for the nonce either.
+var errValidatorExitNotFound = clients.ErrValidatorExitNotFound
+
+// ValidatorExitEvent relays an unstake initiation with a validator-exit.
+type ValidatorExitEvent struct {
+	clients.ValidatorExit
+}
+
+func (e ValidatorExitEvent) Kind() string        { return "validator-exit" }
+func (e ValidatorExitEvent) BlockNumber() string { return e.Block }
+func (e ValidatorExitEvent) TxHash() string      { return e.TransactionHash }
+
+func (e ValidatorExitEvent) Submit(ctx context.Context, submitter clients.Submitter) error {
+	return submitter.SubmitValidatorExit(ctx, e.ValidatorExit)
+}
+
+func (e ValidatorExitEvent) LogAttrs() []any {
+	return []any{"deactivation_epoch", e.DeactivationEpoch}
+}
@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"stake-update-go/clients"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// stakeUpdateTopic is the topic of the StakingInfo event
+// StakeUpdate(uint256 indexed validatorId, uint256 indexed nonce, uint256 indexed newAmount).
+var stakeUpdateTopic = crypto.Keccak256Hash([]byte("StakeUpdate(uint256,uint256,uint256)"))
+
+// errEventMismatch is returned when the subgraph's stake-update doesn't match
+// the event on Ethereum. It's never submitted.
+var errEventMismatch = errors.New("stake-update doesn't match the Ethereum event")
+
+// verifyStakeUpdateEvent checks the subgraph's stake-update against the
+// StakeUpdate event the transaction emitted at its log index, so corrupted
+// or reorged subgraph data is never relayed to Heimdall.
+func (w *Watcher) verifyStakeUpdateEvent(ctx context.Context, validatorId int, stakeUpdate clients.StakeUpdate) error {
+	c := w.Clients(validatorId)
+	receipt, err := c.Blocks.Receipt(ctx, common.HexToHash(stakeUpdate.TransactionHash))
+	if err != nil {
+		return fmt.Errorf("unable to get the stake-update receipt: %v", err)
+	}
+	if receipt.BlockNumber.String() != stakeUpdate.Block {
+		return fmt.Errorf("%w: tx %s is in block %s, the subgraph reports %s", errEventMismatch, stakeUpdate.TransactionHash, receipt.BlockNumber, stakeUpdate.Block)
+	}
+
+	logIndex, err := strconv.ParseUint(stakeUpdate.LogIndex, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid log index %q", errEventMismatch, stakeUpdate.LogIndex)
+	}
+	for _, log := range receipt.Logs {
+		if uint64(log.Index) != logIndex {
+			continue
+		}
+		if len(log.Topics) != 4 || log.Topics[0] != stakeUpdateTopic {
+			return fmt.Errorf("%w: log %d of tx %s is not a StakeUpdate event", errEventMismatch, logIndex, stakeUpdate.TransactionHash)
+		}
+		if address := c.StakingInfoAddress; address != (common.Address{}) && log.Address != address {
+			return fmt.Errorf("%w: log %d of tx %s was emitted by %s, not staking_info_address", errEventMismatch, logIndex, stakeUpdate.TransactionHash, log.Address.Hex())
+		}
+
+		fields := []struct {
+			name     string
+			reported string
+			topic    common.Hash
+		}{
+			{"validator id", stakeUpdate.ValidatorID, log.Topics[1]},
+			{"nonce", stakeUpdate.Nonce, log.Topics[2]},
+			{"staked amount", stakeUpdate.TotalStaked, log.Topics[3]},
+		}
+		for _, field := range fields {
+			onChain := new(big.Int).SetBytes(field.topic.Bytes())
+			if onChain.String() != field.reported {
+				return fmt.Errorf("%w: %s is %s on Ethereum, the subgraph reports %s", errEventMismatch, field.name, onChain, field.reported)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: tx %s has no log %d", errEventMismatch, stakeUpdate.TransactionHash, logIndex)
+}
@@ -0,0 +1,72 @@
+package watch
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// missSearchMaxBlocks bounds the blocks searched for the event of a missing
+// stake-update. A subgraph further behind is lagging regardless.
+const missSearchMaxBlocks = 10000
+
+// Causes of a nonce missing from the subgraph, counted by
+// Metrics.IncSubgraphMiss.
+const (
+	MissIndexingLag = "indexing_lag"
+	MissAbsent      = "absent"
+)
+
+// diagnoseMissingStakeUpdate logs why the subgraph has no stake-update for
+// nonce: either its event is in blocks the subgraph hasn't indexed yet, or
+// it isn't there, which waiting won't fix.
+func (w *Watcher) diagnoseMissingStakeUpdate(ctx context.Context, logger *slog.Logger, validatorId int, nonce int) {
+	p := w.Clients(validatorId)
+	indexed, err := p.Subgraph.IndexedBlock(ctx)
+	if err != nil {
+		logger.Info("Stake update is not indexed by the subGraph yet", "diagnosis_err", err)
+		return
+	}
+	head, err := p.Blocks.Head(ctx, "latest")
+	if err != nil {
+		logger.Info("Stake update is not indexed by the subGraph yet", "indexed_block", indexed, "diagnosis_err", err)
+		return
+	}
+	logger = logger.With("indexed_block", indexed, "head", head)
+
+	if indexed < head && head-indexed > missSearchMaxBlocks {
+		w.Metrics.IncSubgraphMiss(validatorId, MissIndexingLag)
+		logger.Info("Stake update is not indexed by the subGraph yet, the subgraph is far behind the chain head", "lag_blocks", head-indexed)
+		return
+	}
+	if indexed < head {
+		query := ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(indexed + 1),
+			ToBlock:   new(big.Int).SetUint64(head),
+			Topics: [][]common.Hash{
+				{stakeUpdateTopic},
+				{common.BigToHash(big.NewInt(int64(validatorId)))},
+				{common.BigToHash(big.NewInt(int64(nonce)))},
+			},
+		}
+		if address := p.StakingInfoAddress; address != (common.Address{}) {
+			query.Addresses = []common.Address{address}
+		}
+		logs, err := p.Blocks.Logs(ctx, query)
+		if err != nil {
+			logger.Info("Stake update is not indexed by the subGraph yet", "diagnosis_err", err)
+			return
+		}
+		if len(logs) > 0 {
+			w.Metrics.IncSubgraphMiss(validatorId, MissIndexingLag)
+			logger.Info("Stake update is not indexed by the subGraph yet, its event is past the indexed block", "event_block", logs[0].BlockNumber, "tx_hash", logs[0].TxHash.Hex())
+			return
+		}
+	}
+
+	w.Metrics.IncSubgraphMiss(validatorId, MissAbsent)
+	logger.Warn("Stake update is missing from the subGraph although its indexed blocks should contain it, this is a data problem rather than indexing lag")
+}
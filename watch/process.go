@@ -0,0 +1,290 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"stake-update-go/clients"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Outcome is what Process did with a stake-update.
+type Outcome int
+
+const (
+	// ResultSubmitted means the stake-update was submitted, or would have
+	// been in a dry run.
+	ResultSubmitted Outcome = iota
+	// ResultDeferred means the submission was held back for now, e.g. by
+	// throttling, and is retried next cycle.
+	ResultDeferred
+	// ResultPendingFinality means the block is too recent to submit from
+	// yet.
+	ResultPendingFinality
+	// ResultFailed goes along with the error.
+	ResultFailed
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case ResultSubmitted:
+		return "submitted"
+	case ResultDeferred:
+		return "deferred"
+	case ResultPendingFinality:
+		return "pending_finality"
+	default:
+		return "failed"
+	}
+}
+
+// Result is the result of Process. TxHash and BlockAge are set once the
+// stake-update was fetched and its block checked.
+type Result struct {
+	Outcome  Outcome
+	Nonce    int
+	TxHash   string
+	BlockAge time.Duration
+}
+
+// with returns the result with the given outcome.
+func (r Result) with(outcome Outcome) Result {
+	r.Outcome = outcome
+	return r
+}
+
+// Process submits the stake-update for nonce, or the other event taking the
+// nonce. Unless it's ResultSubmitted, later nonces must wait as well.
+func (w *Watcher) Process(ctx context.Context, validatorId int, nonce int) (Result, error) {
+	logger := w.Logger(validatorId).With("nonce", nonce)
+	result := Result{Nonce: nonce}
+	done, ok := w.inFlight.Start(validatorId, nonce)
+	if !ok {
+		logger.Info("Stake update already being submitted, skipping")
+		return result.with(ResultDeferred), nil
+	}
+	defer done()
+	unlock := w.locks.Lock(w.submissionGroup(validatorId))
+	defer unlock()
+
+	if sinceLast := w.since(w.Board.LastSubmit(validatorId)); sinceLast < w.Config.MinSubmitInterval {
+		logger.Info("Deferring stake update, last submission too recent", "since_last", sinceLast.Round(time.Second))
+		return result.with(ResultDeferred), nil
+	}
+
+	// heimdallcli may have broadcast this nonce already without Heimdall
+	// reflecting it yet, e.g. just before a restart.
+	if last, ok := w.State.Last(validatorId); ok && last.Nonce >= nonce && w.since(last.SubmittedAt) < w.Config.ResubmitAfter {
+		logger.Info("Nonce already submitted, waiting for Heimdall to reflect it", "tx_hash", last.TxHash, "submitted_at", last.SubmittedAt)
+		return result.with(ResultDeferred), nil
+	}
+
+	logger.Info("Processing stake update")
+	stakeUpdate, block, err := w.getVerifiedStakeUpdate(ctx, validatorId, nonce)
+	var otherEvent *eventError
+	if errors.As(err, &otherEvent) {
+		return w.processEvent(ctx, logger, result, validatorId, nonce, otherEvent.Event)
+	}
+	if err != nil {
+		return result.with(ResultFailed), err
+	}
+	result.TxHash = stakeUpdate.TransactionHash
+
+	if w.Config.VerifyStakeEvent {
+		if err = w.verifyStakeUpdateEvent(ctx, validatorId, stakeUpdate); err != nil {
+			logger.Error("Stake update failed verification against Ethereum, not submitting", "err", err)
+			return result.with(ResultFailed), err
+		}
+	}
+	return w.submitEvent(ctx, logger, result, validatorId, nonce, StakeUpdateEvent{stakeUpdate}, block)
+}
+
+// checkBlockFinality checks that block is at or below the confirmation block
+// and at least min_block_age_seconds old, setting result.BlockAge. Unless ok,
+// the returned result is what to return instead of submitting.
+func (w *Watcher) checkBlockFinality(ctx context.Context, logger *slog.Logger, validatorId int, block *types.Block, result Result) (Result, bool, error) {
+	tag := w.Config.ConfirmationBlockTag
+	confirmedHead, err := w.Clients(validatorId).Blocks.Head(ctx, tag)
+	if err != nil {
+		logger.Error("Unable to get confirmation block", "tag", tag, "err", err)
+		return result.with(ResultFailed), false, err
+	}
+	if block.NumberU64() > confirmedHead {
+		logger.Info("Block is beyond the confirmation block, not submitting yet", "block", block.NumberU64(), "tag", tag, "confirmed_block", confirmedHead)
+		w.Metrics.IncPendingFinality(validatorId)
+		return result.with(ResultPendingFinality), false, nil
+	}
+
+	age, err := w.blockAge(ctx, validatorId, block)
+	if err != nil {
+		logger.Error("Unable to get the chain head time", "err", err)
+		return result.with(ResultFailed), false, err
+	}
+	result.BlockAge = age
+	if minAge := w.Config.MinBlockAge(validatorId); age < minAge && !w.Config.ForceSubmit {
+		logger.Info("Block is younger than min_block_age_seconds, not submitting yet", "block", block.NumberU64(), "block_age", age.Round(time.Second), "min_block_age", minAge)
+		w.Metrics.IncPendingFinality(validatorId)
+		return result.with(ResultPendingFinality), false, nil
+	}
+	return result, true, nil
+}
+
+// blockAge returns how old block is: against the local clock, or with
+// freshness_source chainhead against the latest block, which doesn't depend
+// on the host clock being right.
+func (w *Watcher) blockAge(ctx context.Context, validatorId int, block *types.Block) (time.Duration, error) {
+	blockTime := time.Unix(int64(block.Time()), 0)
+	if w.Config.FreshnessSource != "chainhead" {
+		return w.since(blockTime), nil
+	}
+
+	c := w.Clients(validatorId)
+	headTime := c.HeadTime
+	if headTime == nil {
+		headTime = c.Blocks.HeadTime
+	}
+	head, err := headTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return head.Sub(blockTime), nil
+}
+
+// recordSubmission records a successful submission of nonce in the metrics,
+// the status board and the state file.
+func (w *Watcher) recordSubmission(logger *slog.Logger, validatorId int, nonce int, txHash string, submitStart time.Time) {
+	w.Metrics.ObserveSubmitDuration(validatorId, w.since(submitStart))
+	submittedAt := w.now()
+	w.Metrics.IncSubmitted(validatorId)
+	w.Metrics.SetLastSubmit(validatorId, submittedAt)
+	w.Board.RecordSubmit(validatorId, submittedAt)
+
+	err := w.State.Record(SubmittedUpdate{
+		ValidatorID: validatorId,
+		Nonce:       nonce,
+		TxHash:      txHash,
+		SubmittedAt: submittedAt,
+	})
+	if err != nil {
+		logger.Error("Error writing state file", "err", err)
+	}
+}
+
+// confirmPollInterval is how often Heimdall is polled while waiting for a
+// submitted nonce.
+const confirmPollInterval = 5 * time.Second
+
+// waitForHeimdallNonce polls Heimdall until the validator nonce reaches
+// nonce, failing after ConfirmTimeout. heimdallcli returning successfully
+// only means the tx was broadcast, it may still be dropped.
+func (w *Watcher) waitForHeimdallNonce(ctx context.Context, logger *slog.Logger, validatorId int, nonce int) error {
+	start := w.now()
+	deadline := start.Add(w.Config.ConfirmTimeout)
+	for {
+		heimdallNonce, err := w.heimdallNonce(ctx, validatorId)
+		if err == nil && heimdallNonce >= nonce {
+			logger.Info("Stake update confirmed on Heimdall", "waited", w.since(start).Round(time.Second))
+			return nil
+		}
+		if err != nil {
+			logger.Warn("Unable to get heimdall nonce while confirming", "err", err)
+		} else {
+			logger.Info("Waiting for Heimdall to reflect the stake update", "heimdall_nonce", heimdallNonce, "waited", w.since(start).Round(time.Second))
+		}
+
+		if w.now().Add(confirmPollInterval).After(deadline) {
+			return fmt.Errorf("stake update nonce %d not reflected on Heimdall after %s", nonce, w.Config.ConfirmTimeout)
+		}
+		select {
+		case <-time.After(confirmPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (w *Watcher) getStakeUpdate(ctx context.Context, validatorId int, nonce int) (clients.StakeUpdate, error) {
+	logger := w.Logger(validatorId).With("nonce", nonce)
+	stakeUpdate, err := w.Clients(validatorId).Subgraph.StakeUpdate(ctx, validatorId, nonce)
+	if err == errStakeUpdateNotIndexed {
+		if event, ok := w.lookupEvent(ctx, logger, validatorId, nonce); ok {
+			return clients.StakeUpdate{}, &eventError{ValidatorID: validatorId, Nonce: nonce, Event: event}
+		}
+		w.diagnoseMissingStakeUpdate(ctx, logger, validatorId, nonce)
+		return clients.StakeUpdate{}, err
+	}
+	if err != nil {
+		logger.Error("Error getting stake update from subGraph", "err", err)
+		w.Metrics.IncSubgraphFailures(validatorId)
+		return clients.StakeUpdate{}, err
+	}
+	if stakeUpdate.ValidatorID != strconv.Itoa(validatorId) || stakeUpdate.Nonce != strconv.Itoa(nonce) {
+		err = fmt.Errorf("%w: got validator %s nonce %s", errStakeUpdateMismatch, stakeUpdate.ValidatorID, stakeUpdate.Nonce)
+		logger.Error("Subgraph returned another stake update than requested", "id", stakeUpdate.ID, "err", err)
+		w.Metrics.IncSubgraphFailures(validatorId)
+		return clients.StakeUpdate{}, err
+	}
+	return stakeUpdate, nil
+}
+
+// errStakeUpdateMismatch is returned when the subgraph answers with the
+// stake-update of another validator or nonce, which is never submitted.
+var errStakeUpdateMismatch = errors.New("subgraph stake-update doesn't match the requested validator and nonce")
+
+// errStakeUpdateNotIndexed is returned while the subgraph hasn't indexed the
+// requested nonce. It classifies as skip, so the loop retries next cycle.
+var errStakeUpdateNotIndexed = clients.ErrStakeUpdateNotIndexed
+
+// getVerifiedStakeUpdate fetches the stake update for nonce along with the
+// block the subgraph places it in, and checks that the RPC agrees the tx is in
+// that block. A disagreement usually means a reorg the subgraph hasn't caught
+// up with yet.
+func (w *Watcher) getVerifiedStakeUpdate(ctx context.Context, validatorId int, nonce int) (clients.StakeUpdate, *types.Block, error) {
+	attempts := 1
+	if w.Config.BlockConflictAction == "requery" {
+		attempts = 2
+	}
+
+	for attempt := 1; ; attempt++ {
+		stakeUpdate, err := w.getStakeUpdate(ctx, validatorId, nonce)
+		if err != nil {
+			return clients.StakeUpdate{}, nil, err
+		}
+
+		block, err := w.Clients(validatorId).Blocks.Block(ctx, stakeUpdate.Block)
+		if err != nil {
+			w.Logger(validatorId).Error("Unable to get block", "nonce", nonce, "block", stakeUpdate.Block, "err", err)
+			return clients.StakeUpdate{}, nil, err
+		}
+
+		if blockContainsTx(block, stakeUpdate.TransactionHash) {
+			return stakeUpdate, block, nil
+		}
+
+		w.logBlockConflict(validatorId, stakeUpdate, block)
+		if attempt >= attempts {
+			return clients.StakeUpdate{}, nil, errBlockConflict
+		}
+		w.Logger(validatorId).Info("Re-querying subGraph after block conflict", "nonce", nonce)
+	}
+}
+
+var errBlockConflict = errors.New("subgraph and RPC disagree on the stake-update block")
+
+func blockContainsTx(block *types.Block, txHash string) bool {
+	return block.Transaction(common.HexToHash(txHash)) != nil
+}
+
+func (w *Watcher) logBlockConflict(validatorId int, stakeUpdate clients.StakeUpdate, block *types.Block) {
+	w.Logger(validatorId).Warn("Block conflict",
+		"nonce", stakeUpdate.Nonce,
+		slog.Group("subgraph", "block", stakeUpdate.Block, "tx_hash", stakeUpdate.TransactionHash, "log_index", stakeUpdate.LogIndex),
+		slog.Group("rpc", "block", block.Number().String(), "block_hash", block.Hash().Hex(), "tx_count", len(block.Transactions())),
+	)
+}
@@ -0,0 +1,150 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"stake-update-go/clients"
+)
+
+func TestProcessOutcomes(t *testing.T) {
+	errSubmit := errors.New("heimdallcli failed")
+	tests := []struct {
+		name string
+		// setup prepares a watcher whose subgraph indexes nonce 4 an hour
+		// ago.
+		setup         func(w *testWatcher)
+		want          Outcome
+		wantErr       error
+		wantSubmitted []string
+	}{
+		{
+			name:          "submitted",
+			setup:         func(w *testWatcher) {},
+			want:          ResultSubmitted,
+			wantSubmitted: []string{"4"},
+		},
+		{
+			name:  "dry run",
+			setup: func(w *testWatcher) { w.Config.DryRun = true },
+			want:  ResultSubmitted,
+		},
+		{
+			name: "deferred after a recent submission",
+			setup: func(w *testWatcher) {
+				w.Config.MinSubmitInterval = time.Hour
+				w.board.lastSubmit = w.clock.Now()
+			},
+			want: ResultDeferred,
+		},
+		{
+			name: "deferred while the nonce awaits Heimdall",
+			setup: func(w *testWatcher) {
+				w.state.Record(SubmittedUpdate{ValidatorID: testValidator, Nonce: 4, SubmittedAt: w.clock.Now()})
+			},
+			want: ResultDeferred,
+		},
+		{
+			name:  "deferred while paused",
+			setup: func(w *testWatcher) { w.pause.paused = true },
+			want:  ResultDeferred,
+		},
+		{
+			name:  "deferred by the circuit breaker",
+			setup: func(w *testWatcher) { w.breaker.open = true },
+			want:  ResultDeferred,
+		},
+		{
+			name:  "pending finality beyond the confirmation block",
+			setup: func(w *testWatcher) { w.blocks.head-- },
+			want:  ResultPendingFinality,
+		},
+		{
+			name:  "pending finality while too young",
+			setup: func(w *testWatcher) { w.Config.MinBlockAge = func(int) time.Duration { return 2 * time.Hour } },
+			want:  ResultPendingFinality,
+		},
+		{
+			name: "too young with force_submit",
+			setup: func(w *testWatcher) {
+				w.Config.MinBlockAge = func(int) time.Duration { return 2 * time.Hour }
+				w.Config.ForceSubmit = true
+			},
+			want:          ResultSubmitted,
+			wantSubmitted: []string{"4"},
+		},
+		{
+			name:    "failed while not indexed",
+			setup:   func(w *testWatcher) { delete(w.subgraph.stakeUpdates, 4) },
+			want:    ResultFailed,
+			wantErr: clients.ErrStakeUpdateNotIndexed,
+		},
+		{
+			name: "failed on a block conflict",
+			setup: func(w *testWatcher) {
+				stakeUpdate := w.subgraph.stakeUpdates[4]
+				stakeUpdate.TransactionHash = "0x" + strings.Repeat("ab", 32)
+				w.subgraph.stakeUpdates[4] = stakeUpdate
+			},
+			want:    ResultFailed,
+			wantErr: errBlockConflict,
+		},
+		{
+			name:    "failed to submit",
+			setup:   func(w *testWatcher) { w.submitter.fail = map[string]error{"4": errSubmit} },
+			want:    ResultFailed,
+			wantErr: errSubmit,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := newTestWatcher(4, 3)
+			w.addStakeUpdate(4, time.Hour)
+			test.setup(w)
+
+			result, err := w.Process(context.Background(), testValidator, 4)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Process = %v, want %v", err, test.wantErr)
+			}
+			if result.Outcome != test.want {
+				t.Errorf("outcome %s, want %s", result.Outcome, test.want)
+			}
+			if got := w.submitter.submittedNonces(); !reflect.DeepEqual(got, test.wantSubmitted) {
+				t.Errorf("submitted nonces %v, want %v", got, test.wantSubmitted)
+			}
+		})
+	}
+}
+
+func TestProcessRejectsMismatchedStakeUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(stakeUpdate *clients.StakeUpdate)
+	}{
+		{name: "another validator", modify: func(stakeUpdate *clients.StakeUpdate) { stakeUpdate.ValidatorID = "8" }},
+		{name: "another nonce", modify: func(stakeUpdate *clients.StakeUpdate) { stakeUpdate.Nonce = "5" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := newTestWatcher(4, 3)
+			stakeUpdate := w.addStakeUpdate(4, time.Hour)
+			test.modify(&stakeUpdate)
+			w.subgraph.stakeUpdates[4] = stakeUpdate
+
+			result, err := w.Process(context.Background(), testValidator, 4)
+			if !errors.Is(err, errStakeUpdateMismatch) {
+				t.Fatalf("Process = %v, want errStakeUpdateMismatch", err)
+			}
+			if result.Outcome != ResultFailed {
+				t.Errorf("outcome %s, want %s", result.Outcome, ResultFailed)
+			}
+			if got := w.submitter.submittedNonces(); len(got) > 0 {
+				t.Errorf("submitted nonces %v, want none", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"strconv"
+	"sync"
+)
+
+func (w *Watcher) submissionGroup(validatorId int) string {
+	if group, ok := w.Config.SubmissionGroups[validatorId]; ok {
+		return group
+	}
+	return strconv.Itoa(validatorId)
+}
+
+// keyedMutex hands out one mutex per key, so submissions sharing a signer
+// account are serialised while different accounts proceed in parallel. The
+// zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// Lock blocks until the mutex for key is held and returns its unlock func.
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*sync.Mutex{}
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		k.locks[key] = lock
+	}
+	k.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+type inFlightKey struct {
+	validatorId int
+	nonce       int
+}
+
+// inFlightSet tracks the nonces being submitted, so a nonce is never worked on
+// twice at the same time. The zero value is ready to use.
+type inFlightSet struct {
+	mu      sync.Mutex
+	entries map[inFlightKey]bool
+}
+
+// Start marks the nonce as in flight and returns the func that clears it, or
+// false when it already is.
+func (s *inFlightSet) Start(validatorId int, nonce int) (func(), bool) {
+	key := inFlightKey{validatorId, nonce}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[key] {
+		return nil, false
+	}
+	if s.entries == nil {
+		s.entries = map[inFlightKey]bool{}
+	}
+	s.entries[key] = true
+	return func() {
+		s.mu.Lock()
+		delete(s.entries, key)
+		s.mu.Unlock()
+	}, true
+}
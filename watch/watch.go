@@ -0,0 +1,311 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"stake-update-go/clients"
+)
+
+// Supervise runs Watch, restarting it with its own backoff when it panics,
+// so a validator hitting a bug only delays itself and never takes down the
+// workers of the others.
+func (w *Watcher) Supervise(ctx context.Context, validatorId int) error {
+	retry := w.newBackoff()
+	for {
+		panicked, err := w.runRecovered(ctx, validatorId)
+		if !panicked {
+			return err
+		}
+		if w.Config.Once || ctx.Err() != nil || w.Drain.Draining() {
+			return err
+		}
+		delay := retry.Next()
+		w.Logger(validatorId).Warn("Restarting validator worker", "delay", delay)
+		w.Board.RecordError(validatorId, err, delay)
+		w.Drain.Sleep(ctx, delay)
+	}
+}
+
+// runRecovered runs Watch, turning a panic into an error.
+func (w *Watcher) runRecovered(ctx context.Context, validatorId int) (panicked bool, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			w.Logger(validatorId).Error("Validator worker panicked", "panic", recovered, "stack", string(debug.Stack()))
+			w.Metrics.IncPanics(validatorId)
+			panicked, err = true, fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return false, w.Watch(ctx, validatorId)
+}
+
+// Watch polls a single validator and submits its pending stake-updates
+// whenever Ethereum is ahead of Heimdall. With Once it returns after the
+// first pass, with the error of any failed step.
+func (w *Watcher) Watch(ctx context.Context, validatorId int) error {
+	logger := w.Logger(validatorId)
+	ethereumNonce := 0
+	var ethereumNonceAt time.Time
+	retry := w.newBackoff()
+	warnedInvalid := false
+	// lagSince is when Ethereum was first seen ahead of Heimdall, zero while
+	// they agree.
+	var lagSince time.Time
+	// release frees the cycle slot, held from the start of a cycle until its
+	// sleep.
+	release := func() {}
+	defer func() { release() }()
+	for ctx.Err() == nil && !w.Drain.Draining() {
+		release = w.Slots.Acquire(ctx)
+		if w.since(ethereumNonceAt) >= w.Config.EthereumNonceRefresh {
+			nonce, err := w.latestNonce(ctx, validatorId)
+			if err != nil {
+				w.Metrics.IncSubgraphFailures(validatorId)
+			}
+			if err != nil && ethereumNonceAt.IsZero() {
+				logger.Error("Error getting ethereum nonce", "err", err)
+				w.Metrics.IncErrors(validatorId)
+				if w.Config.Once {
+					w.Board.RecordError(validatorId, err, 0)
+					return err
+				}
+				delay := retry.Next()
+				w.Board.RecordError(validatorId, err, delay)
+				w.sleepDuring(ctx, release, delay)
+				continue
+			}
+			if err != nil {
+				logger.Warn("Error refreshing ethereum nonce, keeping last known", "eth_nonce", ethereumNonce, "err", err)
+			} else {
+				ethereumNonce = nonce
+				ethereumNonceAt = w.now()
+				w.Ready.NonceFetched(validatorId)
+			}
+		}
+
+		validator, err := w.Clients(validatorId).Heimdall.Validator(ctx, validatorId)
+		if errors.Is(err, clients.ErrValidatorNotFound) {
+			// No stake updates on Ethereum and unknown to Heimdall: almost
+			// certainly a mistyped validator id rather than one that is behind.
+			if ethereumNonce == 0 {
+				if w.Config.StrictMode {
+					return fmt.Errorf("validator %d has no stake updates on Ethereum and is not known to Heimdall", validatorId)
+				}
+				if !warnedInvalid {
+					logger.Warn("Validator has no stake updates on Ethereum and is not known to Heimdall, the id is most likely invalid. Set strict_mode=true to exit instead")
+					warnedInvalid = true
+				}
+				if w.Config.Once {
+					return nil
+				}
+				retry.Success()
+				w.Board.RecordSuccess(validatorId, retry.Current())
+				w.sleepDuring(ctx, release, w.pollDelay(validatorId))
+				continue
+			}
+			logger.Warn("Validator has stake updates on Ethereum but is not known to Heimdall, backing off", "eth_nonce", ethereumNonce, "err", err)
+		}
+		if err != nil {
+			if !errors.Is(err, clients.ErrValidatorNotFound) {
+				logger.Error("Error getting heimdall nonce", "err", err)
+			}
+			w.Metrics.IncErrors(validatorId)
+			if w.Config.Once || w.Classify(err) == CategoryFatal {
+				w.Board.RecordError(validatorId, err, 0)
+				return err
+			}
+			delay := retry.Next()
+			w.Board.RecordError(validatorId, err, delay)
+			w.sleepDuring(ctx, release, delay)
+			continue
+		}
+
+		w.Metrics.SetLastPollSuccess(validatorId, w.now())
+		heimdallNonce := validator.Result.Nonce
+
+		if !w.Config.KeepInactiveValidators {
+			retired, err := w.validatorRetired(ctx, validatorId, validator)
+			if err != nil {
+				logger.Warn("Unable to check deactivation", "err", err)
+			} else if retired {
+				logger.Info("Validator has unstaked, retiring it", "end_epoch", validator.Result.EndEpoch, "power", validator.Result.Power)
+				w.Board.Remove(validatorId)
+				w.Metrics.RemoveValidator(validatorId)
+				return nil
+			} else if validatorExiting(validator, ethereumNonce) {
+				logger.Info("Validator is exiting and Heimdall has every nonce, retiring it", "end_epoch", validator.Result.EndEpoch, "heimdall_nonce", heimdallNonce)
+				w.Board.Remove(validatorId)
+				w.Metrics.RemoveValidator(validatorId)
+				return nil
+			}
+		}
+
+		logger.Info("Nonces", "eth_nonce", ethereumNonce, "heimdall_nonce", heimdallNonce)
+		w.Metrics.SetNonces(validatorId, ethereumNonce, heimdallNonce)
+		w.Metrics.SetNonceLag(validatorId, ethereumNonce-heimdallNonce)
+		w.Board.SetNonces(validatorId, ethereumNonce, heimdallNonce)
+
+		if ethereumNonce > heimdallNonce && lagSince.IsZero() {
+			lagSince = w.now()
+		} else if ethereumNonce <= heimdallNonce && !lagSince.IsZero() {
+			catchUpDuration := w.since(lagSince)
+			logger.Info("Caught up with Ethereum", "heimdall_nonce", heimdallNonce, "catch_up_duration", catchUpDuration.Round(time.Second))
+			w.Metrics.ObserveCatchUpDuration(validatorId, catchUpDuration)
+			lagSince = time.Time{}
+		}
+
+		belowMinPower := w.Config.MinPower > 0 && validator.Result.Power < w.Config.MinPower
+		w.Metrics.SetBelowMinPower(validatorId, belowMinPower)
+		if belowMinPower && ethereumNonce > heimdallNonce {
+			logger.Info("Validator power is below min_power, skipping stake updates", "power", validator.Result.Power, "min_power", w.Config.MinPower)
+		} else if ethereumNonce > heimdallNonce && w.Pause.Paused() {
+			logger.Info("Paused, not submitting stake updates", "lag", ethereumNonce-heimdallNonce)
+		} else if ethereumNonce > heimdallNonce {
+			var summary cycleSummary
+			summary, err = w.catchUp(ctx, validatorId, heimdallNonce+1, ethereumNonce)
+			logCycleSummary(logger, summary)
+			if err != nil {
+				switch w.Classify(err) {
+				case CategorySkip:
+					logger.Info("Skipping stake update this cycle", "err", err)
+				case CategoryFatal:
+					w.Metrics.IncErrors(validatorId)
+					w.Board.RecordError(validatorId, err, 0)
+					return fmt.Errorf("fatal error processing stake update for validator %d: %v", validatorId, err)
+				default:
+					logger.Error("Error processing stake update", "err", err)
+					w.Metrics.IncErrors(validatorId)
+					if w.Config.Once {
+						w.Board.RecordError(validatorId, err, 0)
+						return err
+					}
+					delay := retry.Next()
+					w.Board.RecordError(validatorId, err, delay)
+					w.sleepDuring(ctx, release, delay)
+					continue
+				}
+			}
+		} else {
+			logger.Debug("No updates to process")
+		}
+		if w.Config.Once {
+			return nil
+		}
+		retry.Success()
+		w.Board.RecordSuccess(validatorId, retry.Current())
+		delay := w.pollDelay(validatorId)
+		// Right after a submission Heimdall may not reflect it yet, and
+		// polling would retry the same nonce.
+		if cooldown := w.Config.SubmitCooldown - w.since(w.Board.LastSubmit(validatorId)); cooldown > delay {
+			logger.Debug("Cooling down after a submission", "cooldown", cooldown.Round(time.Second))
+			delay = cooldown
+		}
+		w.sleepDuring(ctx, release, delay)
+	}
+	return nil
+}
+
+// logCycleSummary logs what a cycle did, along with the tx hash of every
+// stake-update submitted.
+func logCycleSummary(logger *slog.Logger, summary cycleSummary) {
+	var submitted []string
+	for _, result := range summary.Results {
+		if result.Outcome == ResultSubmitted {
+			submitted = append(submitted, fmt.Sprintf("%d:%s", result.Nonce, result.TxHash))
+		}
+	}
+	logger.Info("Cycle summary", "submitted", summary.Submitted, "skipped", summary.Skipped, "errors", summary.Errors, "submitted_nonces", strings.Join(submitted, ","))
+}
+
+// cycleSummary counts what catchUp did with the stake-updates of a cycle.
+// Skipped are the ones deferred, pending finality or already on Heimdall.
+type cycleSummary struct {
+	Submitted int
+	Skipped   int
+	Errors    int
+	Results   []Result
+}
+
+func (c *cycleSummary) add(result Result) {
+	c.Results = append(c.Results, result)
+	switch result.Outcome {
+	case ResultSubmitted:
+		c.Submitted++
+	case ResultFailed:
+		c.Errors++
+	default:
+		c.Skipped++
+	}
+}
+
+// catchUp processes every nonce from first to last in ascending order,
+// stopping at the first one that fails or is deferred so ordering is kept.
+// Nonces Heimdall already has are treated as done. At most
+// MaxUpdatesPerCycle are submitted, the rest wait for the next cycle.
+func (w *Watcher) catchUp(ctx context.Context, validatorId int, first int, last int) (cycleSummary, error) {
+	logger := w.Logger(validatorId)
+	var summary cycleSummary
+	for nonce := first; nonce <= last; nonce++ {
+		if ctx.Err() != nil || !w.Drain.Begin() {
+			return summary, nil
+		}
+		result, err := w.Process(ctx, validatorId, nonce)
+		w.Drain.End()
+
+		if err != nil {
+			if w.Classify(err) == CategoryAlreadyExists {
+				logger.Info("Stake update already on Heimdall", "nonce", nonce, "err", err)
+				summary.add(result.with(ResultDeferred))
+				continue
+			}
+			summary.add(result)
+			if w.Classify(err) != CategorySkip {
+				w.Alerts.Failure(validatorId, nonce, err)
+			}
+			if nonce < last {
+				logger.Warn("Stopping catch-up", "nonce", nonce, "pending", last-nonce)
+			}
+			return summary, err
+		}
+		summary.add(result)
+		if result.Outcome != ResultSubmitted {
+			logger.Debug("Stopping catch-up", "nonce", nonce, "result", result.Outcome)
+			return summary, nil
+		}
+		w.Alerts.Success(validatorId, nonce)
+		if summary.Submitted >= w.Config.MaxUpdatesPerCycle && nonce < last {
+			logger.Warn("Reached max_updates_per_cycle, resuming next cycle", "submitted", summary.Submitted, "pending", last-nonce)
+			return summary, nil
+		}
+	}
+	return summary, nil
+}
+
+// validatorRetired reports whether the validator has fully unstaked: its end
+// epoch is set and either its power is gone or the end epoch has passed.
+func (w *Watcher) validatorRetired(ctx context.Context, validatorId int, validator *clients.ValidatorResponse) (bool, error) {
+	if validator.Result.EndEpoch == 0 {
+		return false, nil
+	}
+	if validator.Result.Power == 0 {
+		return true, nil
+	}
+
+	epoch, err := w.Clients(validatorId).Heimdall.Epoch(ctx)
+	if err != nil {
+		return false, err
+	}
+	return validator.Result.EndEpoch <= epoch, nil
+}
+
+// validatorExiting reports whether Heimdall has the validator's exit, i.e.
+// its end epoch is set, and no later nonce is waiting. Such a validator is
+// leaving and has nothing left to reconcile.
+func validatorExiting(validator *clients.ValidatorResponse, ethereumNonce int) bool {
+	return validator.Result.EndEpoch != 0 && ethereumNonce <= validator.Result.Nonce
+}
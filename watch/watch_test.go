@@ -0,0 +1,787 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"stake-update-go/clients"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// testValidator is the validator every test watches.
+const testValidator = 7
+
+var errUnsupported = errors.New("not supported by the fake")
+
+// fakeClock is a clock that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// fakeSubgraph serves stake-updates by nonce. LatestNonce answers with the
+// nonces of latest in turn, repeating the last one, or with latestErr when
+// set.
+type fakeSubgraph struct {
+	mu           sync.Mutex
+	latest       []int
+	latestErr    error
+	stakeUpdates map[int]clients.StakeUpdate
+}
+
+func (s *fakeSubgraph) LatestNonce(ctx context.Context, validatorId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latestErr != nil {
+		return 0, s.latestErr
+	}
+	if len(s.latest) == 0 {
+		return 0, nil
+	}
+	nonce := s.latest[0]
+	if len(s.latest) > 1 {
+		s.latest = s.latest[1:]
+	}
+	return nonce, nil
+}
+
+func (s *fakeSubgraph) LatestNonces(ctx context.Context, validatorIds []int) (map[int]int, error) {
+	return nil, errUnsupported
+}
+
+func (s *fakeSubgraph) StakeUpdate(ctx context.Context, validatorId int, nonce int) (clients.StakeUpdate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stakeUpdate, ok := s.stakeUpdates[nonce]
+	if !ok {
+		return clients.StakeUpdate{}, clients.ErrStakeUpdateNotIndexed
+	}
+	return stakeUpdate, nil
+}
+
+func (s *fakeSubgraph) SignerChange(ctx context.Context, validatorId int, nonce int) (clients.SignerChange, error) {
+	return clients.SignerChange{}, clients.ErrSignerChangeNotFound
+}
+
+func (s *fakeSubgraph) ValidatorExit(ctx context.Context, validatorId int, nonce int) (clients.ValidatorExit, error) {
+	return clients.ValidatorExit{}, clients.ErrValidatorExitNotFound
+}
+
+func (s *fakeSubgraph) StakeUpdatesInRange(ctx context.Context, validatorId int, fromBlock uint64, toBlock uint64) ([]clients.StakeUpdate, error) {
+	return nil, errUnsupported
+}
+
+func (s *fakeSubgraph) IndexedBlock(ctx context.Context) (uint64, error) {
+	return 0, errUnsupported
+}
+
+// fakeHeimdall knows a single validator at nonce, or fails with err when
+// set.
+type fakeHeimdall struct {
+	mu    sync.Mutex
+	nonce int
+	err   error
+}
+
+func (h *fakeHeimdall) Validator(ctx context.Context, validatorId int) (*clients.ValidatorResponse, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &clients.ValidatorResponse{Result: clients.ValidatorInfo{ID: validatorId, Nonce: h.nonce, Power: 10}}, nil
+}
+
+func (h *fakeHeimdall) Epoch(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (h *fakeHeimdall) ValidatorSet(ctx context.Context) ([]int, error) {
+	return []int{testValidator}, nil
+}
+
+func (h *fakeHeimdall) setNonce(nonce int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nonce = nonce
+}
+
+// fakeBlocks serves blocks by number, head being the number of every tag
+// and mined at the time of clock.
+type fakeBlocks struct {
+	blocks map[string]*types.Block
+	head   uint64
+	clock  *fakeClock
+}
+
+func (b *fakeBlocks) Block(ctx context.Context, blockNumber string) (*types.Block, error) {
+	block, ok := b.blocks[blockNumber]
+	if !ok {
+		return nil, fmt.Errorf("block %s not found", blockNumber)
+	}
+	return block, nil
+}
+
+func (b *fakeBlocks) Head(ctx context.Context, tag string) (uint64, error) {
+	return b.head, nil
+}
+
+func (b *fakeBlocks) HeadTime(ctx context.Context) (time.Time, error) {
+	return b.clock.Now(), nil
+}
+
+func (b *fakeBlocks) Receipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return nil, errUnsupported
+}
+
+func (b *fakeBlocks) Logs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return nil, nil
+}
+
+// testHasher stands in for the trie hasher, the tests never checking the
+// roots of their blocks.
+type testHasher struct{}
+
+func (testHasher) Reset()                {}
+func (testHasher) Update([]byte, []byte) {}
+func (testHasher) Hash() common.Hash     { return common.Hash{} }
+
+// fakeSubmitter records the nonces submitted, failing those in fail. Each
+// successful submission moves heimdall to the nonce when set, and calls
+// submitted.
+type fakeSubmitter struct {
+	mu        sync.Mutex
+	nonces    []string
+	fail      map[string]error
+	heimdall  *fakeHeimdall
+	submitted func(nonce string)
+}
+
+func (s *fakeSubmitter) submit(nonce string) error {
+	s.mu.Lock()
+	if err := s.fail[nonce]; err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.nonces = append(s.nonces, nonce)
+	s.mu.Unlock()
+
+	if s.heimdall != nil {
+		n, _ := strconv.Atoi(nonce)
+		s.heimdall.setNonce(n)
+	}
+	if s.submitted != nil {
+		s.submitted(nonce)
+	}
+	return nil
+}
+
+func (s *fakeSubmitter) SubmitStakeUpdate(ctx context.Context, update clients.StakeUpdate) error {
+	return s.submit(update.Nonce)
+}
+
+func (s *fakeSubmitter) SubmitSignerUpdate(ctx context.Context, change clients.SignerChange) error {
+	return s.submit(change.Nonce)
+}
+
+func (s *fakeSubmitter) SubmitValidatorExit(ctx context.Context, exit clients.ValidatorExit) error {
+	return s.submit(exit.Nonce)
+}
+
+func (s *fakeSubmitter) submittedNonces() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.nonces...)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) SetNonces(int, int, int)                   {}
+func (nopMetrics) SetNonceLag(int, int)                      {}
+func (nopMetrics) IncSubmitted(int)                          {}
+func (nopMetrics) IncErrors(int)                             {}
+func (nopMetrics) IncHeimdallcliFailures(int)                {}
+func (nopMetrics) IncSubgraphFailures(int)                   {}
+func (nopMetrics) ObserveSubmitDuration(int, time.Duration)  {}
+func (nopMetrics) SetLastPollSuccess(int, time.Time)         {}
+func (nopMetrics) SetLastSubmit(int, time.Time)              {}
+func (nopMetrics) IncPendingFinality(int)                    {}
+func (nopMetrics) IncPanics(int)                             {}
+func (nopMetrics) IncSubgraphMiss(int, string)               {}
+func (nopMetrics) ObserveCatchUpDuration(int, time.Duration) {}
+func (nopMetrics) SetBelowMinPower(int, bool)                {}
+func (nopMetrics) RemoveValidator(int)                       {}
+
+// fakeBoard keeps only the time of the last submission.
+type fakeBoard struct {
+	mu         sync.Mutex
+	lastSubmit time.Time
+}
+
+func (b *fakeBoard) SetNonces(int, int, int) {}
+
+func (b *fakeBoard) RecordSubmit(validatorId int, at time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastSubmit = at
+}
+
+func (b *fakeBoard) RecordSuccess(int, time.Duration)      {}
+func (b *fakeBoard) RecordError(int, error, time.Duration) {}
+
+func (b *fakeBoard) LastSubmit(validatorId int) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastSubmit
+}
+
+func (b *fakeBoard) Remove(int) {}
+
+type fakeState struct {
+	mu   sync.Mutex
+	last map[int]SubmittedUpdate
+}
+
+func (s *fakeState) Last(validatorId int) (SubmittedUpdate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update, ok := s.last[validatorId]
+	return update, ok
+}
+
+func (s *fakeState) Record(update SubmittedUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil {
+		s.last = map[int]SubmittedUpdate{}
+	}
+	s.last[update.ValidatorID] = update
+	return nil
+}
+
+type fakePause struct{ paused bool }
+
+func (p *fakePause) Paused() bool { return p.paused }
+
+// fakeDrain never drains. Sleep advances clock by the duration instead of
+// waiting, records it and calls slept.
+type fakeDrain struct {
+	clock  *fakeClock
+	sleeps []time.Duration
+	slept  func(duration time.Duration)
+}
+
+func (*fakeDrain) Draining() bool { return false }
+func (*fakeDrain) Begin() bool    { return true }
+func (*fakeDrain) End()           {}
+
+func (d *fakeDrain) Sleep(ctx context.Context, duration time.Duration) {
+	if ctx.Err() != nil {
+		return
+	}
+	d.clock.Advance(duration)
+	d.sleeps = append(d.sleeps, duration)
+	if d.slept != nil {
+		d.slept(duration)
+	}
+}
+
+type nopReady struct{}
+
+func (nopReady) NonceFetched(int) {}
+
+// fakeAlerts records the nonces alerted about.
+type fakeAlerts struct {
+	failures  []int
+	successes []int
+}
+
+func (a *fakeAlerts) Failure(validatorId int, nonce int, err error) {
+	a.failures = append(a.failures, nonce)
+}
+
+func (a *fakeAlerts) Success(validatorId int, nonce int) {
+	a.successes = append(a.successes, nonce)
+}
+
+type nopSlots struct{}
+
+func (nopSlots) Acquire(ctx context.Context) func() { return func() {} }
+
+type fakeBreaker struct{ open bool }
+
+func (b *fakeBreaker) Allow() bool                           { return !b.open }
+func (b *fakeBreaker) Record(ctx context.Context, err error) {}
+
+type nopCommands struct{}
+
+func (nopCommands) Record(int, int, []string) error { return nil }
+
+// errAlreadyExists stands for Heimdall rejecting a nonce it already has.
+var errAlreadyExists = errors.New("tx already exists in cache")
+
+// errFatal stands for an error no retry can fix.
+var errFatal = errors.New("invalid validator configuration")
+
+func testClassify(err error) Category {
+	switch {
+	case errors.Is(err, clients.ErrStakeUpdateNotIndexed):
+		return CategorySkip
+	case errors.Is(err, errAlreadyExists):
+		return CategoryAlreadyExists
+	case errors.Is(err, errFatal):
+		return CategoryFatal
+	}
+	return CategoryRetry
+}
+
+// testWatcher is a Watcher of testValidator wired to fakes.
+type testWatcher struct {
+	*Watcher
+	subgraph  *fakeSubgraph
+	heimdall  *fakeHeimdall
+	blocks    *fakeBlocks
+	submitter *fakeSubmitter
+	board     *fakeBoard
+	state     *fakeState
+	pause     *fakePause
+	breaker   *fakeBreaker
+	alerts    *fakeAlerts
+	clock     *fakeClock
+	drain     *fakeDrain
+	// audits holds the dry-run flag of every audited submission.
+	audits []bool
+}
+
+// newTestWatcher returns a watcher running a single cycle, with Ethereum at
+// ethereumNonce and Heimdall at heimdallNonce.
+func newTestWatcher(ethereumNonce int, heimdallNonce int) *testWatcher {
+	clock := newFakeClock()
+	w := &testWatcher{
+		subgraph:  &fakeSubgraph{latest: []int{ethereumNonce}, stakeUpdates: map[int]clients.StakeUpdate{}},
+		heimdall:  &fakeHeimdall{nonce: heimdallNonce},
+		blocks:    &fakeBlocks{blocks: map[string]*types.Block{}, clock: clock},
+		submitter: &fakeSubmitter{},
+		board:     &fakeBoard{},
+		state:     &fakeState{},
+		pause:     &fakePause{},
+		breaker:   &fakeBreaker{},
+		alerts:    &fakeAlerts{},
+		clock:     clock,
+		drain:     &fakeDrain{clock: clock},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	w.Watcher = &Watcher{
+		Config: Config{
+			Once:                 true,
+			SubmitMode:           "rpc",
+			ConfirmationBlockTag: "latest",
+			FreshnessSource:      "wallclock",
+			PollInterval:         func(int) time.Duration { return time.Millisecond },
+			MinBlockAge:          func(int) time.Duration { return time.Minute },
+			ResubmitAfter:        time.Minute,
+			MaxUpdatesPerCycle:   10,
+			Backoff:              Backoff{Base: time.Millisecond, Max: time.Millisecond, ResetSuccesses: 1},
+		},
+		Clients: func(int) Clients {
+			return Clients{Subgraph: w.subgraph, Heimdall: w.heimdall, Blocks: w.blocks, Submitter: w.submitter, Breaker: w.breaker}
+		},
+		Logger:   func(int) *slog.Logger { return logger },
+		Classify: testClassify,
+		Metrics:  nopMetrics{},
+		Board:    w.board,
+		State:    w.state,
+		Pause:    w.pause,
+		Drain:    w.drain,
+		Ready:    nopReady{},
+		Alerts:   w.alerts,
+		Slots:    nopSlots{},
+		Args:     func(Event) []string { return nil },
+		Commands: nopCommands{},
+		Audit: func(validatorId int, nonce int, event Event, dryRun bool, err error) {
+			w.audits = append(w.audits, dryRun)
+		},
+		Now: clock.Now,
+	}
+	return w
+}
+
+// addStakeUpdate indexes a stake-update for nonce whose block was mined age
+// before the clock, and returns it.
+func (w *testWatcher) addStakeUpdate(nonce int, age time.Duration) clients.StakeUpdate {
+	number := uint64(100 + nonce)
+	tx := types.NewTransaction(uint64(nonce), common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	header := &types.Header{Number: new(big.Int).SetUint64(number), Time: uint64(w.clock.Now().Add(-age).Unix())}
+	block := types.NewBlock(header, []*types.Transaction{tx}, nil, nil, testHasher{})
+
+	stakeUpdate := clients.StakeUpdate{
+		ID:              fmt.Sprintf("%s-%d", tx.Hash().Hex(), 0),
+		ValidatorID:     strconv.Itoa(testValidator),
+		TotalStaked:     "1000",
+		Block:           strconv.FormatUint(number, 10),
+		Nonce:           strconv.Itoa(nonce),
+		TransactionHash: tx.Hash().Hex(),
+		LogIndex:        "0",
+	}
+	w.subgraph.stakeUpdates[nonce] = stakeUpdate
+	w.blocks.blocks[stakeUpdate.Block] = block
+	if number > w.blocks.head {
+		w.blocks.head = number
+	}
+	return stakeUpdate
+}
+
+func TestWatchDecisions(t *testing.T) {
+	const old, fresh = time.Hour, 0
+	const pollInterval, submitCooldown = 18 * time.Second, 5 * time.Minute
+	errHeimdall := errors.New("heimdall returned 502")
+	errSubmit := errors.New("heimdallcli failed")
+	tests := []struct {
+		name          string
+		ethereumNonce int
+		heimdallNonce int
+		// ages are the block ages of the indexed stake-updates by nonce.
+		ages  map[int]time.Duration
+		setup func(w *testWatcher)
+		// wantAction is what the cycle ends with: poll sleeps the poll
+		// interval, cooldown the submit cooldown, retry backs off and stop
+		// returns an error.
+		wantAction    string
+		wantSubmitted []string
+		wantAudits    []bool
+	}{
+		{
+			name:          "up to date",
+			ethereumNonce: 3,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{3: old},
+			wantAction:    "poll",
+		},
+		{
+			name:          "lagging",
+			ethereumNonce: 5,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: old, 5: old},
+			wantAction:    "poll",
+			wantSubmitted: []string{"4", "5"},
+			wantAudits:    []bool{false, false},
+		},
+		{
+			name:          "lagging with a submit cooldown",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: old},
+			setup:         func(w *testWatcher) { w.Config.SubmitCooldown = submitCooldown },
+			wantAction:    "cooldown",
+			wantSubmitted: []string{"4"},
+			wantAudits:    []bool{false},
+		},
+		{
+			name:          "too fresh",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: fresh},
+			wantAction:    "poll",
+		},
+		{
+			name:          "lagging then too fresh",
+			ethereumNonce: 5,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: old, 5: fresh},
+			wantAction:    "poll",
+			wantSubmitted: []string{"4"},
+			wantAudits:    []bool{false},
+		},
+		{
+			name:          "exactly min_block_age old",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: time.Minute},
+			wantAction:    "poll",
+			wantSubmitted: []string{"4"},
+			wantAudits:    []bool{false},
+		},
+		{
+			name:          "a second younger than min_block_age",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: time.Minute - time.Second},
+			wantAction:    "poll",
+		},
+		{
+			name:          "nonce not indexed by the subgraph",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			wantAction:    "poll",
+		},
+		{
+			name:          "unknown to Heimdall without an Ethereum nonce",
+			ethereumNonce: 0,
+			setup:         func(w *testWatcher) { w.heimdall.err = clients.ErrValidatorNotFound },
+			wantAction:    "poll",
+		},
+		{
+			name:          "unknown to Heimdall with an Ethereum nonce",
+			ethereumNonce: 4,
+			ages:          map[int]time.Duration{4: old},
+			setup:         func(w *testWatcher) { w.heimdall.err = clients.ErrValidatorNotFound },
+			wantAction:    "retry",
+		},
+		{
+			name:          "Heimdall retryable error",
+			ethereumNonce: 4,
+			ages:          map[int]time.Duration{4: old},
+			setup:         func(w *testWatcher) { w.heimdall.err = errHeimdall },
+			wantAction:    "retry",
+		},
+		{
+			name:          "Heimdall fatal error",
+			ethereumNonce: 4,
+			ages:          map[int]time.Duration{4: old},
+			setup:         func(w *testWatcher) { w.heimdall.err = errFatal },
+			wantAction:    "stop",
+		},
+		{
+			name:          "subgraph error",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: old},
+			setup:         func(w *testWatcher) { w.subgraph.latestErr = errors.New("subgraph returned 503") },
+			wantAction:    "retry",
+		},
+		{
+			name:          "dry run",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: old},
+			setup:         func(w *testWatcher) { w.Config.DryRun = true },
+			wantAction:    "poll",
+			wantAudits:    []bool{true},
+		},
+		{
+			name:          "submit retryable failure",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: old},
+			setup:         func(w *testWatcher) { w.submitter.fail = map[string]error{"4": errSubmit} },
+			wantAction:    "retry",
+			wantAudits:    []bool{false},
+		},
+		{
+			name:          "submit fatal failure",
+			ethereumNonce: 4,
+			heimdallNonce: 3,
+			ages:          map[int]time.Duration{4: old},
+			setup:         func(w *testWatcher) { w.submitter.fail = map[string]error{"4": errFatal} },
+			wantAction:    "stop",
+			wantAudits:    []bool{false},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			w := newTestWatcher(test.ethereumNonce, test.heimdallNonce)
+			w.Config.Once = false
+			w.Config.PollInterval = func(int) time.Duration { return pollInterval }
+			w.Config.Backoff = Backoff{Base: time.Second, Max: time.Second, ResetSuccesses: 1}
+			for nonce, age := range test.ages {
+				w.addStakeUpdate(nonce, age)
+			}
+			if test.setup != nil {
+				test.setup(w)
+			}
+			// Stop after the first cycle, once its sleep tells what it ended
+			// with.
+			w.drain.slept = func(time.Duration) { cancel() }
+
+			err := w.Watch(ctx, testValidator)
+			var action string
+			switch {
+			case err != nil:
+				action = "stop"
+			case len(w.drain.sleeps) != 1:
+				t.Fatalf("Watch returned after sleeping %v, want a single sleep", w.drain.sleeps)
+			case w.drain.sleeps[0] == pollInterval:
+				action = "poll"
+			case w.drain.sleeps[0] == submitCooldown:
+				action = "cooldown"
+			case w.drain.sleeps[0] <= time.Second:
+				action = "retry"
+			default:
+				t.Fatalf("Watch slept %s, neither polling, cooling down nor backing off", w.drain.sleeps[0])
+			}
+			if action != test.wantAction {
+				t.Errorf("cycle ended with %s (err %v, sleeps %v), want %s", action, err, w.drain.sleeps, test.wantAction)
+			}
+			if got := w.submitter.submittedNonces(); !reflect.DeepEqual(got, test.wantSubmitted) {
+				t.Errorf("submitted nonces %v, want %v", got, test.wantSubmitted)
+			}
+			if !reflect.DeepEqual(w.audits, test.wantAudits) {
+				t.Errorf("audited dry runs %v, want %v", w.audits, test.wantAudits)
+			}
+		})
+	}
+}
+
+func TestCatchUpOutcomes(t *testing.T) {
+	const old, fresh = time.Hour, 0
+	errSubmit := errors.New("heimdallcli failed")
+	tests := []struct {
+		name string
+		// ages are the block ages of the indexed stake-updates by nonce.
+		ages          map[int]time.Duration
+		fail          map[string]error
+		maxUpdates    int
+		wantSummary   cycleSummary
+		wantOutcomes  []Outcome
+		wantErr       error
+		wantSubmitted []string
+		wantFailures  []int
+	}{
+		{
+			name:          "all submitted",
+			ages:          map[int]time.Duration{4: old, 5: old, 6: old},
+			wantSummary:   cycleSummary{Submitted: 3},
+			wantOutcomes:  []Outcome{ResultSubmitted, ResultSubmitted, ResultSubmitted},
+			wantSubmitted: []string{"4", "5", "6"},
+		},
+		{
+			name:          "stops at pending finality",
+			ages:          map[int]time.Duration{4: old, 5: fresh, 6: old},
+			wantSummary:   cycleSummary{Submitted: 1, Skipped: 1},
+			wantOutcomes:  []Outcome{ResultSubmitted, ResultPendingFinality},
+			wantSubmitted: []string{"4"},
+		},
+		{
+			name:          "stops at a nonce not indexed",
+			ages:          map[int]time.Duration{4: old, 6: old},
+			wantSummary:   cycleSummary{Submitted: 1, Errors: 1},
+			wantOutcomes:  []Outcome{ResultSubmitted, ResultFailed},
+			wantErr:       clients.ErrStakeUpdateNotIndexed,
+			wantSubmitted: []string{"4"},
+		},
+		{
+			name:          "stops at a failed submission",
+			ages:          map[int]time.Duration{4: old, 5: old, 6: old},
+			fail:          map[string]error{"5": errSubmit},
+			wantSummary:   cycleSummary{Submitted: 1, Errors: 1},
+			wantOutcomes:  []Outcome{ResultSubmitted, ResultFailed},
+			wantErr:       errSubmit,
+			wantSubmitted: []string{"4"},
+			wantFailures:  []int{5},
+		},
+		{
+			name:          "continues past a nonce already on Heimdall",
+			ages:          map[int]time.Duration{4: old, 5: old, 6: old},
+			fail:          map[string]error{"4": errAlreadyExists},
+			wantSummary:   cycleSummary{Submitted: 2, Skipped: 1},
+			wantOutcomes:  []Outcome{ResultDeferred, ResultSubmitted, ResultSubmitted},
+			wantSubmitted: []string{"5", "6"},
+		},
+		{
+			name:          "stops at max_updates_per_cycle",
+			ages:          map[int]time.Duration{4: old, 5: old, 6: old},
+			maxUpdates:    2,
+			wantSummary:   cycleSummary{Submitted: 2},
+			wantOutcomes:  []Outcome{ResultSubmitted, ResultSubmitted},
+			wantSubmitted: []string{"4", "5"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := newTestWatcher(6, 3)
+			for nonce, age := range test.ages {
+				w.addStakeUpdate(nonce, age)
+			}
+			w.submitter.fail = test.fail
+			if test.maxUpdates > 0 {
+				w.Config.MaxUpdatesPerCycle = test.maxUpdates
+			}
+
+			summary, err := w.catchUp(context.Background(), testValidator, 4, 6)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("catchUp = %v, want %v", err, test.wantErr)
+			}
+			var outcomes []Outcome
+			for i, result := range summary.Results {
+				outcomes = append(outcomes, result.Outcome)
+				if result.Nonce != 4+i {
+					t.Errorf("result %d is of nonce %d, want %d", i, result.Nonce, 4+i)
+				}
+			}
+			if !reflect.DeepEqual(outcomes, test.wantOutcomes) {
+				t.Errorf("outcomes %v, want %v", outcomes, test.wantOutcomes)
+			}
+			summary.Results = nil
+			if !reflect.DeepEqual(summary, test.wantSummary) {
+				t.Errorf("summary %+v, want %+v", summary, test.wantSummary)
+			}
+			if got := w.submitter.submittedNonces(); !reflect.DeepEqual(got, test.wantSubmitted) {
+				t.Errorf("submitted nonces %v, want %v", got, test.wantSubmitted)
+			}
+			if !reflect.DeepEqual(w.alerts.failures, test.wantFailures) {
+				t.Errorf("alerted failures %v, want %v", w.alerts.failures, test.wantFailures)
+			}
+		})
+	}
+}
+
+func TestWatchFollowsRisingEthereumNonce(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Heimdall is caught up at first, then Ethereum moves ahead one nonce per
+	// cycle, each submission reaching Heimdall straight away.
+	w := newTestWatcher(3, 3)
+	w.Config.Once = false
+	w.subgraph.latest = []int{3, 3, 4, 5, 6}
+	for nonce := 4; nonce <= 6; nonce++ {
+		w.addStakeUpdate(nonce, time.Hour)
+	}
+	w.submitter.heimdall = w.heimdall
+	w.submitter.submitted = func(nonce string) {
+		if nonce == "6" {
+			cancel()
+		}
+	}
+
+	if err := w.Watch(ctx, testValidator); err != nil {
+		t.Fatalf("Watch = %v", err)
+	}
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("Watch returned before submitting nonce 6: %v", ctx.Err())
+	}
+	if got, want := w.submitter.submittedNonces(), []string{"4", "5", "6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("submitted nonces %v, want %v", got, want)
+	}
+}
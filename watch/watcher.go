@@ -0,0 +1,248 @@
+// Package watch polls validators and relays their pending nonce events from
+// Ethereum to Heimdall. A Watcher holds everything it works with as fields,
+// wired by main to the real services and state, or by tests to fakes.
+package watch
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"stake-update-go/clients"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Watcher watches validators and submits their pending stake-updates,
+// signer changes and unstakes. It must not be copied once used.
+type Watcher struct {
+	Config Config
+	// Clients returns the services validatorId is served by.
+	Clients func(validatorId int) Clients
+	// Logger returns the logger of validatorId.
+	Logger func(validatorId int) *slog.Logger
+	// Classify decides how the loop reacts to an error.
+	Classify func(err error) Category
+
+	Metrics Metrics
+	Board   Board
+	State   State
+	Pause   Pauser
+	Drain   Drainer
+	Ready   Readiness
+	Alerts  Alerter
+	Slots   Slots
+
+	// Args returns the heimdallcli arguments submitting event, logged and
+	// passed to Commands with submit_mode exec.
+	Args     func(event Event) []string
+	Commands CommandRecorder
+	// Confirm asks the operator to confirm the submission of event, every
+	// submission going ahead when nil.
+	Confirm func(ctx context.Context, event Event) bool
+	// Audit records the submission attempt of event, which returned err.
+	Audit func(validatorId int, nonce int, event Event, dryRun bool, err error)
+	// Now returns the current time, time.Now when nil. Block ages, submit
+	// intervals and cooldowns are measured against it, and the loop waits
+	// through Drain.Sleep, so tests can drive both.
+	Now func() time.Time
+
+	inFlight inFlightSet
+	locks    keyedMutex
+}
+
+// Config holds the settings of a Watcher.
+type Config struct {
+	// Once runs a single catch-up pass per validator.
+	Once                   bool
+	DryRun                 bool
+	StrictMode             bool
+	KeepInactiveValidators bool
+	// ForceSubmit skips the MinBlockAge check.
+	ForceSubmit      bool
+	VerifyStakeEvent bool
+	// SubmitMode is exec or rpc.
+	SubmitMode string
+	// BlockConflictAction is retry or requery.
+	BlockConflictAction  string
+	ConfirmationBlockTag string
+	// FreshnessSource is wallclock or chainhead.
+	FreshnessSource string
+	MinPower        int
+
+	// PollInterval and MinBlockAge return the settings of a validator.
+	PollInterval      func(validatorId int) time.Duration
+	MinBlockAge       func(validatorId int) time.Duration
+	PollJitterPercent int
+
+	EthereumNonceRefresh time.Duration
+	MinSubmitInterval    time.Duration
+	SubmitCooldown       time.Duration
+	ResubmitAfter        time.Duration
+	ConfirmTimeout       time.Duration
+	MaxUpdatesPerCycle   int
+	// SubmissionGroups maps validator ids to the key of the group whose
+	// submissions are serialised, the validator being its own group unless
+	// listed.
+	SubmissionGroups map[int]string
+	// Backoff holds the settings of the retry backoffs.
+	Backoff Backoff
+}
+
+// Clients are the services a validator is served by, those of its profile.
+type Clients struct {
+	Subgraph  clients.Subgraph
+	Heimdall  clients.Heimdall
+	Blocks    clients.Blocks
+	Submitter clients.Submitter
+	// Breaker is the circuit breaker of the profile's submissions.
+	Breaker Breaker
+	// LatestNonce returns the latest Ethereum nonce of a validator,
+	// Subgraph.LatestNonce when nil.
+	LatestNonce func(ctx context.Context, validatorId int) (int, error)
+	// HeadTime returns the chain head time for freshness_source chainhead,
+	// Blocks.HeadTime when nil.
+	HeadTime func(ctx context.Context) (time.Time, error)
+	// StakingInfoAddress is the StakingInfo contract events must come from,
+	// any when zero.
+	StakingInfoAddress common.Address
+}
+
+// Metrics are the metrics a Watcher reports, all labelled by validator.
+type Metrics interface {
+	SetNonces(validatorId int, ethereumNonce int, heimdallNonce int)
+	SetNonceLag(validatorId int, lag int)
+	IncSubmitted(validatorId int)
+	IncErrors(validatorId int)
+	IncHeimdallcliFailures(validatorId int)
+	IncSubgraphFailures(validatorId int)
+	ObserveSubmitDuration(validatorId int, duration time.Duration)
+	SetLastPollSuccess(validatorId int, at time.Time)
+	SetLastSubmit(validatorId int, at time.Time)
+	IncPendingFinality(validatorId int)
+	IncPanics(validatorId int)
+	IncSubgraphMiss(validatorId int, cause string)
+	ObserveCatchUpDuration(validatorId int, duration time.Duration)
+	SetBelowMinPower(validatorId int, below bool)
+	RemoveValidator(validatorId int)
+}
+
+// Board holds the status of every watched validator.
+type Board interface {
+	SetNonces(validatorId int, ethereumNonce int, heimdallNonce int)
+	RecordSubmit(validatorId int, at time.Time)
+	RecordSuccess(validatorId int, backoff time.Duration)
+	RecordError(validatorId int, err error, backoff time.Duration)
+	LastSubmit(validatorId int) time.Time
+	Remove(validatorId int)
+}
+
+// SubmittedUpdate is the record kept for the last nonce submitted for a
+// validator.
+type SubmittedUpdate struct {
+	ValidatorID int       `json:"validatorId"`
+	Nonce       int       `json:"nonce"`
+	TxHash      string    `json:"txHash"`
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// State keeps the last submission of every validator across restarts.
+type State interface {
+	Last(validatorId int) (SubmittedUpdate, bool)
+	Record(update SubmittedUpdate) error
+}
+
+// Pauser reports whether submissions are held back.
+type Pauser interface {
+	Paused() bool
+}
+
+// Drainer lets a shutdown wait for the submissions in progress.
+type Drainer interface {
+	Draining() bool
+	// Begin starts a submission, false once draining.
+	Begin() bool
+	End()
+	// Sleep waits for duration, returning early when ctx is done or a drain
+	// starts.
+	Sleep(ctx context.Context, duration time.Duration)
+}
+
+// Readiness is told once each validator's first Ethereum nonce is fetched.
+type Readiness interface {
+	NonceFetched(validatorId int)
+}
+
+// Alerter is told the outcome of every nonce submitted.
+type Alerter interface {
+	Failure(validatorId int, nonce int, err error)
+	Success(validatorId int, nonce int)
+}
+
+// Slots bounds how many validators run a cycle at the same time. Acquire
+// returns the func releasing the slot, which may be called more than once.
+type Slots interface {
+	Acquire(ctx context.Context) func()
+}
+
+// Breaker holds back submissions after repeated failures. Every submission
+// Allow lets through is reported with Record.
+type Breaker interface {
+	Allow() bool
+	Record(ctx context.Context, err error)
+}
+
+// CommandRecorder records every heimdallcli command about to be run.
+type CommandRecorder interface {
+	Record(validatorId int, nonce int, args []string) error
+}
+
+// Category decides how the loop reacts to a failure.
+type Category string
+
+const (
+	// CategoryRetry retries after a short delay.
+	CategoryRetry Category = "retry"
+	// CategoryFatal stops the validator's worker.
+	CategoryFatal Category = "fatal"
+	// CategoryAlreadyExists means Heimdall already has the update, so it is
+	// treated as done.
+	CategoryAlreadyExists Category = "already-exists"
+	// CategorySkip gives up on the current cycle and waits for the next poll.
+	CategorySkip Category = "skip"
+)
+
+func (w *Watcher) latestNonce(ctx context.Context, validatorId int) (int, error) {
+	c := w.Clients(validatorId)
+	if c.LatestNonce != nil {
+		return c.LatestNonce(ctx, validatorId)
+	}
+	return c.Subgraph.LatestNonce(ctx, validatorId)
+}
+
+func (w *Watcher) heimdallNonce(ctx context.Context, validatorId int) (int, error) {
+	validator, err := w.Clients(validatorId).Heimdall.Validator(ctx, validatorId)
+	if err != nil {
+		return 0, err
+	}
+	return validator.Result.Nonce, nil
+}
+
+func (w *Watcher) now() time.Time {
+	if w.Now != nil {
+		return w.Now()
+	}
+	return time.Now()
+}
+
+// since returns the time elapsed since t, by now.
+func (w *Watcher) since(t time.Time) time.Duration {
+	return w.now().Sub(t)
+}
+
+// sleepDuring is Drain.Sleep for a worker holding a cycle slot, releasing
+// the slot first.
+func (w *Watcher) sleepDuring(ctx context.Context, release func(), delay time.Duration) {
+	release()
+	w.Drain.Sleep(ctx, delay)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"stake-update-go/watch"
+)
+
+// newWatcher wires a watch.Watcher to the configuration, services and state
+// of the process. It is called once they are all set up.
+func newWatcher() *watch.Watcher {
+	watcher := &watch.Watcher{
+		Config: watch.Config{
+			Once:                   Once,
+			DryRun:                 DryRun,
+			StrictMode:             StrictMode,
+			KeepInactiveValidators: KeepInactiveValidators,
+			ForceSubmit:            ForceSubmit,
+			VerifyStakeEvent:       VerifyStakeEvent,
+			SubmitMode:             SubmitMode,
+			BlockConflictAction:    BlockConflictAction,
+			ConfirmationBlockTag:   ConfirmationBlockTag,
+			FreshnessSource:        FreshnessSource,
+			MinPower:               MinPower,
+			PollInterval:           validatorPollInterval,
+			MinBlockAge:            validatorMinBlockAge,
+			PollJitterPercent:      PollJitterPercent,
+			EthereumNonceRefresh:   EthereumNonceRefresh,
+			MinSubmitInterval:      MinSubmitInterval,
+			SubmitCooldown:         SubmitCooldown,
+			ResubmitAfter:          ResubmitAfter,
+			ConfirmTimeout:         ConfirmTimeout,
+			MaxUpdatesPerCycle:     MaxUpdatesPerCycle,
+			SubmissionGroups:       SubmissionGroups,
+			Backoff:                *newBackoff(),
+		},
+		Clients:  validatorClients,
+		Logger:   validatorLogger,
+		Classify: classifyError,
+		Metrics:  metrics,
+		Board:    board,
+		State:    stateStore,
+		Pause:    pause,
+		Drain:    drain,
+		Ready:    ready,
+		Alerts:   alerts,
+		Slots:    cycleSlots,
+		Args:     eventArgs,
+		Commands: commandLog,
+		Audit:    auditEvent,
+	}
+	if Interactive {
+		watcher.Confirm = confirmEvent
+	}
+	return watcher
+}
+
+// newBackoff returns a backoff with the backoff_* settings.
+func newBackoff() *watch.Backoff {
+	return &watch.Backoff{
+		Base:           BackoffBase,
+		Max:            BackoffMax,
+		ResetSuccesses: BackoffResetSuccesses,
+	}
+}
+
+// validatorClients returns the services of the validator's profile.
+func validatorClients(validatorId int) watch.Clients {
+	p := validatorProfile(validatorId)
+	return watch.Clients{
+		Subgraph:           p.Subgraph,
+		Heimdall:           p.Heimdall,
+		Blocks:             p.Blocks,
+		Submitter:          p.Submitter,
+		Breaker:            p.breaker,
+		LatestNonce:        getEthereumValidatorNonce,
+		HeadTime:           p.chainHeadTime,
+		StakingInfoAddress: profileConfigOf(p).StakingInfoAddress,
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"stake-update-go/watch"
+)
+
+// cycleLimiter bounds how many validators run a cycle at the same time, so
+// a large fleet doesn't hit the subgraph and Heimdall all at once.
+type cycleLimiter struct {
+	slots chan struct{}
+}
+
+// cycleSlots is set up by runWatch from max_concurrent_validators.
+var cycleSlots = newCycleLimiter(0)
+
+// newCycleLimiter returns a limiter of size slots, zero not limiting.
+func newCycleLimiter(size int) *cycleLimiter {
+	if size == 0 {
+		return &cycleLimiter{}
+	}
+	return &cycleLimiter{slots: make(chan struct{}, size)}
+}
+
+// Acquire blocks until a slot is free or ctx is done, and returns the func
+// that releases it. It may be called more than once.
+func (l *cycleLimiter) Acquire(ctx context.Context) func() {
+	if l.slots == nil {
+		return func() {}
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return func() {}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.slots })
+	}
+}
+
+// workerPool runs a worker per validator. Workers can be added and stopped
+// one at a time while the pool runs, as -all does when the validator set
+// changes.
+type workerPool struct {
+	ctx     context.Context
+	watcher *watch.Watcher
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	jitter  bool
+	// cancels holds every validator started and not stopped, including the
+	// ones whose worker already returned, so they aren't started again.
+	cancels map[int]context.CancelFunc
+	// active holds the validators whose worker is still running.
+	active map[int]bool
+	failed int
+}
+
+func newWorkerPool(ctx context.Context, watcher *watch.Watcher, jitter bool) *workerPool {
+	return &workerPool{ctx: ctx, watcher: watcher, jitter: jitter, cancels: map[int]context.CancelFunc{}, active: map[int]bool{}}
+}
+
+// Start runs a worker for validatorId unless it already has one.
+func (p *workerPool) Start(validatorId int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.cancels[validatorId]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.cancels[validatorId] = cancel
+	p.active[validatorId] = true
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() {
+			p.mu.Lock()
+			delete(p.active, validatorId)
+			p.mu.Unlock()
+		}()
+		// Spread the first polls of many validators over one interval.
+		if p.jitter {
+			drain.Sleep(ctx, watch.RandomDuration(validatorPollInterval(validatorId)))
+		}
+		err := p.watcher.Supervise(ctx, validatorId)
+		if ctx.Err() != nil && p.ctx.Err() == nil {
+			// Stopped by Stop, not a failure.
+			return
+		}
+		if err != nil {
+			validatorLogger(validatorId).Error("Stopped watching", "err", err)
+			p.mu.Lock()
+			p.failed++
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// Go runs fn along with the workers, so the pool isn't done before it
+// returns.
+func (p *workerPool) Go(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn()
+	}()
+}
+
+// Stop stops the worker of validatorId and drops its status and metrics.
+func (p *workerPool) Stop(validatorId int) {
+	p.mu.Lock()
+	cancel, ok := p.cancels[validatorId]
+	delete(p.cancels, validatorId)
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	cancel()
+	board.Remove(validatorId)
+	metrics.RemoveValidator(validatorId)
+	ready.Forget(validatorId)
+}
+
+// Running returns the validators that were started and not stopped.
+func (p *workerPool) Running() map[int]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	running := make(map[int]bool, len(p.cancels))
+	for validatorId := range p.cancels {
+		running[validatorId] = true
+	}
+	return running
+}
+
+// Active returns the validators whose worker is still running, leaving out
+// the ones retired, stopped or that failed for good.
+func (p *workerPool) Active() map[int]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	active := make(map[int]bool, len(p.active))
+	for validatorId := range p.active {
+		active[validatorId] = true
+	}
+	return active
+}
+
+// Failed returns how many workers stopped with an error.
+func (p *workerPool) Failed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.failed
+}
+
+// Done returns a channel closed once every worker has returned.
+func (p *workerPool) Done() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	return done
+}